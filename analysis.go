@@ -0,0 +1,485 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// each traverses the directory structure starting at root using the configuration of s
+// and calls visit for every matching entry, from multiple goroutines.
+// The traversal always runs to completion and the first error encountered is returned.
+func (s *Scanner) each(root string, visit func(string, os.DirEntry)) error {
+	return firstError(s.collect(context.Background(), root, false, func(p string, de os.DirEntry, _ int) bool {
+		visit(p, de)
+		return true
+	}))
+}
+
+// group traverses the directory structure starting at root using the configuration of s
+// and collects the matching paths into buckets keyed by the value returned by key.
+// Entries for which key reports false are left out of every bucket.
+func group[K comparable](s *Scanner, root string, key func(string, os.DirEntry) (K, bool)) (map[K][]string, error) {
+	var mu sync.Mutex
+	g := make(map[K][]string)
+
+	err := s.each(root, func(p string, de os.DirEntry) {
+		k, ok := key(p, de)
+		if !ok {
+			return
+		}
+		mu.Lock()
+		g[k] = append(g[k], p)
+		mu.Unlock()
+	})
+	return g, err
+}
+
+// shared returns the buckets of g holding more than one path, each sorted.
+func shared[K comparable](g map[K][]string) map[K][]string {
+	r := make(map[K][]string)
+	for k, ps := range g {
+		if len(ps) > 1 {
+			slices.Sort(ps)
+			r[k] = ps
+		}
+	}
+	return r
+}
+
+// FindCaseCollisions scans the directory structure starting at root and reports
+// entries of the same directory whose names differ only by case (e.g. README.md and Readme.md).
+// Such entries cannot coexist on case-insensitive filesystems like the macOS and Windows defaults.
+// The result maps the lowercased path of each clash to the sorted paths sharing it.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func FindCaseCollisions(root string, maxDepth int, opts ...Option) (map[string][]string, error) {
+	g, err := group(newScanner(maxDepth, nil, opts), root, func(p string, de os.DirEntry) (string, bool) {
+		return filepath.Join(filepath.Dir(p), strings.ToLower(de.Name())), true
+	})
+	return shared(g), err
+}
+
+// FindDuplicateNames scans the directory structure starting at root and groups the matching entries
+// by base name, returning the names found in more than one location mapped to their sorted paths.
+// Same-named files are likely accidental copies, and finding them is much cheaper than hashing contents.
+// Names are compared exactly, see FindCaseCollisions for names differing only by case.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func FindDuplicateNames(root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) (map[string][]string, error) {
+	g, err := group(newScanner(maxDepth, filter, opts), root, func(_ string, de os.DirEntry) (string, bool) {
+		return de.Name(), true
+	})
+	return shared(g), err
+}
+
+// Summary holds aggregate figures about the entries matched by a scan.
+type Summary struct {
+	// Files is the number of matching entries that are not directories.
+	Files int
+	// Dirs is the number of matching directories.
+	Dirs int
+	// Bytes is the total size of the matching files.
+	Bytes int64
+	// Largest is the path of the largest matching file and LargestSize its size.
+	Largest     string
+	LargestSize int64
+	// Newest is the path of the most recently modified matching file and NewestTime its modification time.
+	Newest     string
+	NewestTime time.Time
+	// Extensions counts the matching files by lowercased extension, including the leading dot.
+	// Files without an extension are counted under the empty string.
+	Extensions map[string]int
+}
+
+// ScanSummary scans the directory structure starting at root and aggregates the matching
+// entries into a Summary in a single traversal.
+// Sizes and modification times come from the entries metadata, files whose metadata
+// can't be read are counted but don't contribute to them.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanSummary(root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) (Summary, error) {
+	var mu sync.Mutex
+	sm := Summary{Extensions: make(map[string]int)}
+
+	err := newScanner(maxDepth, filter, opts).each(root, func(p string, de os.DirEntry) {
+		if de.IsDir() {
+			mu.Lock()
+			sm.Dirs++
+			mu.Unlock()
+			return
+		}
+
+		i, ierr := de.Info()
+		ext := strings.ToLower(filepath.Ext(de.Name()))
+
+		mu.Lock()
+		defer mu.Unlock()
+		sm.Files++
+		sm.Extensions[ext]++
+		if ierr != nil {
+			return
+		}
+		sm.Bytes += i.Size()
+		if sm.Largest == "" || i.Size() > sm.LargestSize {
+			sm.Largest, sm.LargestSize = p, i.Size()
+		}
+		if sm.Newest == "" || i.ModTime().After(sm.NewestTime) {
+			sm.Newest, sm.NewestTime = p, i.ModTime()
+		}
+	})
+	return sm, err
+}
+
+// ScanGrowth scans the directory structure starting at root and compares the size of every
+// matching file against the previous snapshot, which maps paths to sizes as recorded by an earlier run.
+// It returns the files that grew since the snapshot, mapped to the number of bytes they grew by.
+// Files missing from the snapshot are not reported.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanGrowth(root string, maxDepth int, previous map[string]int64, filter func(string, os.DirEntry) bool, opts ...Option) (map[string]int64, error) {
+	var mu sync.Mutex
+	grown := make(map[string]int64)
+
+	err := newScanner(maxDepth, filter, opts).each(root, func(p string, de os.DirEntry) {
+		old, ok := previous[p]
+		if !ok || de.IsDir() {
+			return
+		}
+		i, err := de.Info()
+		if err != nil || i.Size() <= old {
+			return
+		}
+		mu.Lock()
+		grown[p] = i.Size() - old
+		mu.Unlock()
+	})
+	return grown, err
+}
+
+// FileState is the metadata DetectChanges compares between two runs to tell whether a file changed.
+type FileState struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// DetectChanges scans the directory structure starting at root and compares the files found against
+// the previous snapshot, a polling alternative to filesystem notifications. It returns the sorted paths
+// added, removed and modified (different size or modification time) since the snapshot, and the current
+// snapshot, which callers persist and pass as previous to the next run. A nil previous reports every file as added.
+// Directories are not tracked, and files whose metadata can't be read keep their previous state, or are
+// left out of the snapshot if they're new.
+//
+// A directory that can't be read, or a symbolic link that can't be followed, doesn't make its files look
+// removed: their previous states are carried over to the current snapshot unchanged, and the first error is
+// returned along with the changes found elsewhere. If the traversal is aborted, like with MaxErrors, nothing
+// is known to be removed: no change is reported, current is previous and the error is returned.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func DetectChanges(root string, maxDepth int, previous map[string]FileState, opts ...Option) (added, removed, modified []string, current map[string]FileState, err error) {
+	var mu sync.Mutex
+	current = make(map[string]FileState)
+
+	errs := newScanner(maxDepth, nil, opts).collect(context.Background(), root, false, func(p string, de os.DirEntry, _ int) bool {
+		if de.IsDir() {
+			return true
+		}
+		st, ok := previous[p]
+		if i, err := de.Info(); err == nil {
+			st, ok = FileState{Size: i.Size(), ModTime: i.ModTime()}, true
+		}
+		if ok {
+			mu.Lock()
+			current[p] = st
+			mu.Unlock()
+		}
+		return true
+	})
+
+	// failed lists the directories whose contents are unknown.
+	var failed []string
+	for _, e := range errs {
+		var pe *fs.PathError
+		if !errors.As(e, &pe) {
+			return nil, nil, nil, previous, errs[0]
+		}
+		failed = append(failed, filepath.Clean(pe.Path))
+	}
+	if len(errs) > 0 {
+		err = errs[0]
+	}
+
+	for p, st := range current {
+		old, ok := previous[p]
+		switch {
+		case !ok:
+			added = append(added, p)
+		case old.Size != st.Size || !old.ModTime.Equal(st.ModTime):
+			modified = append(modified, p)
+		}
+	}
+	for p, st := range previous {
+		if _, ok := current[p]; ok {
+			continue
+		}
+		if slices.ContainsFunc(failed, func(d string) bool {
+			rel, err := filepath.Rel(d, p)
+			return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+		}) {
+			current[p] = st
+			continue
+		}
+		removed = append(removed, p)
+	}
+	slices.Sort(added)
+	slices.Sort(removed)
+	slices.Sort(modified)
+	return added, removed, modified, current, err
+}
+
+// ScanCount scans the directory structure starting at root and returns the number of matching entries,
+// without keeping their paths, so that memory stays flat whatever the size of the tree.
+// The count is that of the paths ScanSyncPartial would return; the first error is returned with it.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanCount(root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) (int, error) {
+	var n atomic.Int64
+	err := newScanner(maxDepth, filter, opts).each(root, func(string, os.DirEntry) {
+		n.Add(1)
+	})
+	return int(n.Load()), err
+}
+
+// EstimateProgressTotal scans the directory structure starting at root and returns the number of entries
+// the traversal visits, matching or not: the value a counter set with WithProgressCounter reaches at the end
+// of a scan with the same arguments, as long as the tree doesn't change in between. Running it first gives
+// the total that turns the counter into a percentage, at the cost of an extra traversal.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func EstimateProgressTotal(root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) (int64, error) {
+	var n int64
+	s := newScanner(maxDepth, filter, opts)
+	s.Progress = &n
+	err := s.each(root, func(string, os.DirEntry) {})
+	return atomic.LoadInt64(&n), err
+}
+
+// ScanSize scans the directory structure starting at root and returns the number of matching entries and
+// the total size of the matching regular files in a single traversal, sparing an os.Stat per result.
+// Directories, symbolic links and other non regular entries are counted but contribute zero bytes,
+// links are not resolved, and files whose size can't be read are counted without their size.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanSize(root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) (count int64, totalBytes int64, err error) {
+	var n, b atomic.Int64
+
+	err = newScanner(maxDepth, filter, opts).each(root, func(_ string, de os.DirEntry) {
+		n.Add(1)
+		if !de.Type().IsRegular() {
+			return
+		}
+		if i, err := de.Info(); err == nil {
+			b.Add(i.Size())
+		}
+	})
+	return n.Load(), b.Load(), err
+}
+
+// ScanSizeByExtension scans the directory structure starting at root and sums the size of the regular files
+// per lowercased extension, including the leading dot, which tells what file types use the most space.
+// Files without an extension are summed under the empty string, and files whose size can't be read are left out.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanSizeByExtension(root string, maxDepth int, opts ...Option) (map[string]int64, error) {
+	var mu sync.Mutex
+	r := make(map[string]int64)
+
+	err := newScanner(maxDepth, nil, opts).each(root, func(_ string, de os.DirEntry) {
+		if !de.Type().IsRegular() {
+			return
+		}
+		i, err := de.Info()
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		r[strings.ToLower(filepath.Ext(de.Name()))] += i.Size()
+		mu.Unlock()
+	})
+	return r, err
+}
+
+// ScanLanguageBreakdown scans the directory structure starting at root and counts the matching files
+// per language, mapping their extension through extToLang (e.g. ".go" to "Go").
+// Extensions are compared case-insensitively and may be given with or without the leading dot.
+// Files whose extension is not in the map are counted under "other".
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanLanguageBreakdown(root string, maxDepth int, extToLang map[string]string, filter func(string, os.DirEntry) bool, opts ...Option) (map[string]int, error) {
+	langs := make(map[string]string, len(extToLang))
+	for e, l := range extToLang {
+		langs["."+strings.TrimPrefix(strings.ToLower(e), ".")] = l
+	}
+
+	var mu sync.Mutex
+	r := make(map[string]int)
+	err := newScanner(maxDepth, filter, opts).each(root, func(_ string, de os.DirEntry) {
+		if de.IsDir() {
+			return
+		}
+		l, ok := langs[strings.ToLower(filepath.Ext(de.Name()))]
+		if !ok {
+			l = "other"
+		}
+		mu.Lock()
+		r[l]++
+		mu.Unlock()
+	})
+	return r, err
+}
+
+// GroupBySize scans the directory structure starting at root and groups the matching regular files
+// by size, each group sorted by path. Only files sharing their size with another one can be duplicates,
+// which makes this the cheap first stage of duplicate detection: groups of a single file can be discarded
+// before hashing the rest. Files whose size can't be read are left out.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func GroupBySize(root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) (map[int64][]string, error) {
+	g, err := group(newScanner(maxDepth, filter, opts), root, func(_ string, de os.DirEntry) (int64, bool) {
+		if !de.Type().IsRegular() {
+			return 0, false
+		}
+		i, err := de.Info()
+		if err != nil {
+			return 0, false
+		}
+		return i.Size(), true
+	})
+
+	for _, ps := range g {
+		slices.Sort(ps)
+	}
+	return g, err
+}
+
+// ScanMatchDirs scans the directory structure starting at root and returns the sorted set of
+// directories holding at least one matching file, e.g. the packages of a tree with FilterByExtension(".go").
+// Matching directories are included as they are, not their parent.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanMatchDirs(root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) ([]string, error) {
+	var mu sync.Mutex
+	set := make(map[string]bool)
+
+	err := newScanner(maxDepth, filter, opts).each(root, func(p string, de os.DirEntry) {
+		if !de.IsDir() {
+			p = filepath.Dir(p)
+		}
+		mu.Lock()
+		set[p] = true
+		mu.Unlock()
+	})
+	return slices.Sorted(maps.Keys(set)), err
+}
+
+// ScanDepthStats scans the directory structure starting at root and reports how deep it goes:
+// the deepest level holding an entry, the average depth of the entries and the number of entries
+// at each depth. Entries directly under root have depth 0, like for maxDepth, so the statistics
+// help choosing its value. When no entry is found, the histogram is empty and both values are zero.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanDepthStats(root string, maxDepth int, opts ...Option) (maxDepthFound int, avgDepth float64, depthHistogram map[int]int, err error) {
+	var mu sync.Mutex
+	depthHistogram = make(map[int]int)
+	err = firstError(newScanner(maxDepth, nil, opts).collect(context.Background(), root, false, func(_ string, _ os.DirEntry, d int) bool {
+		mu.Lock()
+		depthHistogram[d]++
+		mu.Unlock()
+		return true
+	}))
+
+	var n, sum int
+	for d, c := range depthHistogram {
+		maxDepthFound = max(maxDepthFound, d)
+		n += c
+		sum += d * c
+	}
+	if n > 0 {
+		avgDepth = float64(sum) / float64(n)
+	}
+	return maxDepthFound, avgDepth, depthHistogram, err
+}
+
+// MaxSequenceSpan is the largest difference between the lowest and the highest number of a sequence
+// ScanSequenceGaps accepts, which bounds the number of gaps it can report.
+const MaxSequenceSpan = 1 << 20
+
+// ErrSequenceSpan is returned by ScanSequenceGaps when the numbers found span more than MaxSequenceSpan,
+// like a stray img_20240115120000.jpg next to img_1.jpg, instead of listing billions of gaps.
+var ErrSequenceSpan = errors.New("sequence span too large")
+
+// ScanSequenceGaps scans the files directly under root whose name matches pattern and reports, in increasing
+// order, the integers missing between the lowest and the highest number found (e.g. missing frames or pages).
+// The pattern is a literal file name holding the placeholder {n} exactly once, which matches a run of digits:
+// "frame_{n}.png" matches frame_1.png as well as the zero-padded frame_0001.png, both standing for 1.
+// Numbers too large for an int are ignored. If the highest and lowest numbers are more than MaxSequenceSpan
+// apart, no gap is reported and an error matching ErrSequenceSpan is returned.
+func ScanSequenceGaps(root string, pattern string) (missing []int, err error) {
+	if strings.Count(pattern, "{n}") != 1 {
+		return nil, fmt.Errorf("sequence pattern %q must hold the {n} placeholder exactly once", pattern)
+	}
+	before, after, _ := strings.Cut(pattern, "{n}")
+	re := regexp.MustCompile("^" + regexp.QuoteMeta(before) + `(\d+)` + regexp.QuoteMeta(after) + "$")
+
+	var mu sync.Mutex
+	seen := make(map[int]bool)
+	err = newScanner(0, nil, nil).each(root, func(_ string, de os.DirEntry) {
+		if de.IsDir() {
+			return
+		}
+		m := re.FindStringSubmatch(de.Name())
+		if m == nil {
+			return
+		}
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		seen[n] = true
+		mu.Unlock()
+	})
+
+	if len(seen) == 0 {
+		return nil, err
+	}
+	lo, hi := math.MaxInt, math.MinInt
+	for n := range seen {
+		lo, hi = min(lo, n), max(hi, n)
+	}
+	if hi-lo > MaxSequenceSpan {
+		return nil, errors.Join(fmt.Errorf("numbers from %d to %d: %w", lo, hi, ErrSequenceSpan), err)
+	}
+	for n := lo; n < hi; n++ {
+		if !seen[n] {
+			missing = append(missing, n)
+		}
+	}
+	return missing, err
+}
+
+// AnyMatch reports whether any entry under root matches filter. The traversal stops as soon as the
+// first match is found, every worker is canceled and has returned before AnyMatch does.
+// Errors encountered before a match don't matter once one is found; when nothing matches the first
+// error is returned alongside false.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func AnyMatch(root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) (bool, error) {
+	var found atomic.Bool
+	errs := newScanner(maxDepth, filter, opts).collect(context.Background(), root, false, func(string, os.DirEntry, int) bool {
+		found.Store(true)
+		return false
+	})
+	if found.Load() {
+		return true, nil
+	}
+	return false, firstError(errs)
+}
@@ -0,0 +1,182 @@
+package scanner
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// newHash returns a new hash for the named algorithm: md5, sha1, sha256 or sha512.
+func newHash(algo string) (hash.Hash, error) {
+	switch strings.ToLower(algo) {
+	case "md5":
+		return md5.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm %q", algo)
+}
+
+// hashFile returns the lowercase hex digest of the file at p computed with the named algorithm.
+func hashFile(p string, algo string) (string, error) {
+	h, err := newHash(algo)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashEach scans root with the configuration of s and hashes the matching regular files for which
+// want returns true with the named algorithm, calling done with each path and its digest or error.
+// Hashing runs on a separate pool of s.HashWorkers goroutines fed while the traversal goes on, so
+// that reading directories and hashing files proceed concurrently with independent limits.
+// want and done are called from multiple goroutines and must be safe for concurrent use.
+// The first traversal error is returned once every file has been hashed.
+func (s *Scanner) hashEach(root string, algo string, want func(string) bool, done func(p string, sum string, err error)) error {
+	n := s.HashWorkers
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+
+	jobs := make(chan string, n)
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				sum, err := hashFile(p, algo)
+				done(p, sum, err)
+			}
+		}()
+	}
+
+	err := s.each(root, func(p string, de os.DirEntry) {
+		if de.Type().IsRegular() && want(p) {
+			jobs <- p
+		}
+	})
+	close(jobs)
+	wg.Wait()
+	return err
+}
+
+// FilterByChecksumSet returns a filter function that matches regular files whose digest,
+// computed with the named algorithm (md5, sha1, sha256 or sha512), is in hashes as lowercase hex.
+// It reads every regular file in full, so the I/O cost is that of the whole tree: combine it with
+// cheaper filters, like FilterBySize when the sizes of the known files are known, through a custom filter.
+// The set is read concurrently by the worker goroutines and must not be modified during the scan.
+// An unsupported algorithm matches nothing.
+func FilterByChecksumSet(algo string, hashes map[string]bool) func(string, os.DirEntry) bool {
+	if _, err := newHash(algo); err != nil {
+		return func(string, os.DirEntry) bool { return false }
+	}
+	return func(p string, de os.DirEntry) bool {
+		if !de.Type().IsRegular() {
+			return false
+		}
+		sum, err := hashFile(p, algo)
+		return err == nil && hashes[sum]
+	}
+}
+
+// VerifyManifest checks the files under root against a manifest, much like sha256sum -c does.
+// Each line of the manifest holds a path relative to root, with forward slashes, followed by
+// whitespace and the hex digest of the file: the path comes first, the reverse of the lines
+// written by sha256sum, which can't be read as is. Empty lines and lines starting with # are ignored.
+// The algorithm can be md5, sha1, sha256 or sha512.
+// It returns the listed files whose current digest differs or that can't be read as mismatches,
+// and the listed files that are no longer found under root as missing; ok is true when both are empty.
+// If part of root can't be traversed, the check still completes and the first traversal error is returned.
+// Files are hashed by a pool of workers running alongside the traversal, see Scanner.HashWorkers.
+// RelativeBase and Transform are ignored, the manifest paths being relative to root already.
+func VerifyManifest(root string, manifestPath string, algo string, opts ...Option) (ok bool, mismatches []string, missing []string, err error) {
+	if _, err := newHash(algo); err != nil {
+		return false, nil, nil, err
+	}
+
+	f, err := os.Open(manifestPath)
+	if err != nil {
+		return false, nil, nil, err
+	}
+	defer f.Close()
+
+	want := make(map[string]string)
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		l := strings.TrimSpace(sc.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		i := strings.LastIndexAny(l, " \t")
+		if i < 0 {
+			return false, nil, nil, fmt.Errorf("%s:%d: malformed manifest line", manifestPath, n)
+		}
+		want[filepath.Clean(filepath.FromSlash(strings.TrimSpace(l[:i])))] = strings.ToLower(l[i+1:])
+	}
+	if err := sc.Err(); err != nil {
+		return false, nil, nil, err
+	}
+
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	// The manifest lists paths relative to root, which the files are opened and looked up by.
+	s := newScanner(-1, nil, opts)
+	s.RelativeBase, s.Transform = "", nil
+	err = s.hashEach(root, algo, func(p string) bool {
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return false
+		}
+		if _, ok := want[rel]; !ok {
+			return false
+		}
+		mu.Lock()
+		seen[rel] = true
+		mu.Unlock()
+		return true
+	}, func(p string, sum string, err error) {
+		rel, _ := filepath.Rel(root, p)
+		if err != nil || sum != want[rel] {
+			mu.Lock()
+			mismatches = append(mismatches, rel)
+			mu.Unlock()
+		}
+	})
+
+	for rel := range want {
+		if !seen[rel] {
+			missing = append(missing, rel)
+		}
+	}
+
+	slices.Sort(mismatches)
+	slices.Sort(missing)
+	return err == nil && len(mismatches) == 0 && len(missing) == 0, mismatches, missing, err
+}
@@ -0,0 +1,195 @@
+package scanner
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"  // register the GIF decoder for FilterByImageSize
+	_ "image/jpeg" // register the JPEG decoder for FilterByImageSize
+	_ "image/png"  // register the PNG decoder for FilterByImageSize
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLen is the number of leading bytes read to tell text files from binary ones.
+// It is the same amount inspected by git.
+const sniffLen = 8000
+
+// readHead returns the first n bytes of the regular file at p, or less if the file is shorter.
+// ok is false for non regular entries and for files that can't be read.
+func readHead(p string, de os.DirEntry, n int) (b []byte, ok bool) {
+	if !de.Type().IsRegular() {
+		return nil, false
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	b = make([]byte, n)
+	n, err = io.ReadFull(f, b)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, false
+	}
+	return b[:n], true
+}
+
+// sniffText reports whether the regular file at p looks like text, using the git heuristic:
+// a file is binary if its first sniffLen bytes contain a NUL byte.
+// ok is false for non regular entries and for files that can't be read.
+func sniffText(p string, de os.DirEntry) (text bool, ok bool) {
+	b, ok := readHead(p, de, sniffLen)
+	if !ok {
+		return false, false
+	}
+	return bytes.IndexByte(b, 0) < 0, true
+}
+
+// FilterText returns true only for regular files that look like text.
+// It reads the first 8000 bytes of every regular file and treats it as text when they contain
+// no NUL byte, like git does. Empty files count as text.
+// Directories, other non regular entries and unreadable files are skipped.
+func FilterText(p string, de os.DirEntry) bool {
+	t, ok := sniffText(p, de)
+	return ok && t
+}
+
+// FilterBinary returns true only for regular files that look binary.
+// It reads the first 8000 bytes of every regular file and treats it as binary when they contain
+// a NUL byte, like git does. Empty files count as text.
+// Directories, other non regular entries and unreadable files are skipped.
+func FilterBinary(p string, de os.DirEntry) bool {
+	t, ok := sniffText(p, de)
+	return ok && !t
+}
+
+// FilterByMIMEType returns a filter function that matches regular files whose content type, as detected
+// by http.DetectContentType from their first 512 bytes, starts with mime, so that "image/png" matches PNG files
+// whatever their extension and "image/" matches every image type it knows. Text files are detected with their
+// charset, like "text/plain; charset=utf-8". The comparison ignores case.
+// It opens every regular file it is called on, so it is expensive: put a cheaper filter before it with And,
+// like FilterBySize. Directories, other non regular entries and unreadable files return false.
+func FilterByMIMEType(mime string) func(string, os.DirEntry) bool {
+	mime = strings.ToLower(mime)
+	return func(p string, de os.DirEntry) bool {
+		b, ok := readHead(p, de, 512)
+		return ok && strings.HasPrefix(http.DetectContentType(b), mime)
+	}
+}
+
+// imageExts lists the extensions FilterByImageSize tries to decode.
+var imageExts = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true,
+	".bmp": true, ".webp": true, ".tif": true, ".tiff": true,
+}
+
+// FilterByImageSize returns a filter function that matches images at least minW pixels wide
+// and minH pixels high. Only files with an image extension are opened, and only their header
+// is decoded with image.DecodeConfig, never the whole image.
+// The package registers the PNG, JPEG and GIF decoders; to match other formats like BMP, WebP
+// or TIFF, import their decoders (e.g. golang.org/x/image/webp) for their side effects.
+// Non images and files that can't be decoded return false.
+func FilterByImageSize(minW, minH int) func(string, os.DirEntry) bool {
+	return func(p string, de os.DirEntry) bool {
+		if de.IsDir() || !imageExts[strings.ToLower(filepath.Ext(de.Name()))] {
+			return false
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return false
+		}
+		defer f.Close()
+
+		c, _, err := image.DecodeConfig(f)
+		if err != nil {
+			return false
+		}
+		return c.Width >= minW && c.Height >= minH
+	}
+}
+
+// chunkLen is the size of the chunks read by the content filters.
+const chunkLen = 32 << 10
+
+// fileContains reports whether the regular file at p contains needle, reading it in chunks so that
+// large files are never loaded in memory. Matches spanning two chunks are found by carrying the tail
+// of each chunk over to the next one. If fold is true, the needle must already be lowercased and the
+// chunks are lowercased before matching. If text is true, files looking binary return false.
+func fileContains(p string, needle []byte, fold, text bool) bool {
+	f, err := os.Open(p)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	tail := max(len(needle)-1, 0)
+	buf := make([]byte, tail+chunkLen)
+	keep := 0
+	for first := true; ; first = false {
+		n, err := io.ReadFull(f, buf[keep:])
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return false
+		}
+		data := buf[:keep+n]
+		if first && text && bytes.IndexByte(data[:min(len(data), sniffLen)], 0) >= 0 {
+			return false
+		}
+
+		hay := data
+		if fold {
+			hay = bytes.ToLower(data)
+		}
+		if bytes.Contains(hay, needle) {
+			return true
+		}
+		if err != nil {
+			return false
+		}
+
+		keep = min(tail, len(data))
+		copy(buf, data[len(data)-keep:])
+	}
+}
+
+// FilterContains returns a filter function that matches text files containing substr.
+// It reads every regular file in chunks and looks for the literal substring, which is much cheaper
+// than a regular expression. Directories, binary files (see FilterText) and unreadable files return false.
+func FilterContains(substr string) func(string, os.DirEntry) bool {
+	needle := []byte(substr)
+	return func(p string, de os.DirEntry) bool {
+		return de.Type().IsRegular() && fileContains(p, needle, false, true)
+	}
+}
+
+// FilterContainsFold is like FilterContains but ignores case, lowercasing both substr and the file contents.
+func FilterContainsFold(substr string) func(string, os.DirEntry) bool {
+	needle := bytes.ToLower([]byte(substr))
+	return func(p string, de os.DirEntry) bool {
+		return de.Type().IsRegular() && fileContains(p, needle, true, true)
+	}
+}
+
+// FilterByContent returns a filter function that matches regular files containing the bytes of needle,
+// binary files included, reading them in chunks like FilterContains. When maxSize is positive, files larger
+// than maxSize bytes are skipped without being opened, to avoid reading giant binaries.
+// Directories, other non regular entries and unreadable files return false.
+func FilterByContent(needle []byte, maxSize int64) func(string, os.DirEntry) bool {
+	needle = bytes.Clone(needle)
+	return func(p string, de os.DirEntry) bool {
+		if !de.Type().IsRegular() {
+			return false
+		}
+		if maxSize > 0 {
+			i, err := de.Info()
+			if err != nil || i.Size() > maxSize {
+				return false
+			}
+		}
+		return fileContains(p, needle, false, false)
+	}
+}
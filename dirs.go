@@ -0,0 +1,45 @@
+package scanner
+
+import "os"
+
+// ensure creates the directory d computed by one of the directory helpers, with its parents,
+// if it doesn't exist yet, and returns it.
+func ensure(d string, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(d, 0o700); err != nil {
+		return "", err
+	}
+	return d, nil
+}
+
+// EnsureConfigDir is like ConfigDir but also creates the directory, readable by the current user only,
+// if it doesn't exist. An existing directory is returned as is.
+func EnsureConfigDir(dir string) (string, error) {
+	return ensure(ConfigDir(dir))
+}
+
+// EnsureDataDir is like DataDir but also creates the directory, readable by the current user only,
+// if it doesn't exist. An existing directory is returned as is.
+func EnsureDataDir(dir string) (string, error) {
+	return ensure(DataDir(dir))
+}
+
+// EnsureCacheDir is like CacheDir but also creates the directory, readable by the current user only,
+// if it doesn't exist. An existing directory is returned as is.
+func EnsureCacheDir(dir string) (string, error) {
+	return ensure(CacheDir(dir))
+}
+
+// EnsureStateDir is like StateDir but also creates the directory, readable by the current user only,
+// if it doesn't exist. An existing directory is returned as is.
+func EnsureStateDir(dir string) (string, error) {
+	return ensure(StateDir(dir))
+}
+
+// EnsureRuntimeDir is like RuntimeDir but also creates the directory, readable by the current user only,
+// if it doesn't exist. An existing directory is returned as is.
+func EnsureRuntimeDir(dir string) (string, error) {
+	return ensure(RuntimeDir(dir))
+}
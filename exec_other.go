@@ -0,0 +1,18 @@
+//go:build !windows
+
+package scanner
+
+import "os"
+
+// FilterExecutable returns true for regular files with an execute permission bit set,
+// for the owner, the group or the others. Entries whose info can't be read return false.
+func FilterExecutable(_ string, de os.DirEntry) bool {
+	if !de.Type().IsRegular() {
+		return false
+	}
+	i, err := de.Info()
+	if err != nil {
+		return false
+	}
+	return i.Mode().Perm()&0o111 != 0
+}
@@ -0,0 +1,22 @@
+//go:build windows
+
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FilterExecutable returns true for regular files with an executable extension, .exe, .bat, .cmd
+// or .com in any case, since permission bits don't tell whether a file runs on Windows.
+func FilterExecutable(_ string, de os.DirEntry) bool {
+	if !de.Type().IsRegular() {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(de.Name())) {
+	case ".exe", ".bat", ".cmd", ".com":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !windows
+
+package scanner
+
+import "errors"
+
+// freeSpace is not supported on this system, the free space check is skipped.
+func freeSpace(string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
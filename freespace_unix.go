@@ -0,0 +1,18 @@
+//go:build linux || darwin
+
+package scanner
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// freeSpace returns the number of bytes available to the user on the filesystem holding p.
+func freeSpace(p string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(p, &st); err != nil {
+		return 0, &os.PathError{Op: "statfs", Path: p, Err: err}
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,22 @@
+//go:build windows
+
+package scanner
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// freeSpace returns the number of bytes available to the user on the volume holding p.
+func freeSpace(p string) (uint64, error) {
+	pp, err := windows.UTF16PtrFromString(p)
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	if err := windows.GetDiskFreeSpaceEx(pp, &n, nil, nil); err != nil {
+		return 0, &os.PathError{Op: "GetDiskFreeSpaceEx", Path: p, Err: err}
+	}
+	return n, nil
+}
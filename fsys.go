@@ -0,0 +1,53 @@
+package scanner
+
+import (
+	"io/fs"
+	"strings"
+)
+
+// ScanFS synchronously scans the directory structure of fsys starting at root, which must be a valid
+// io/fs path like "." or "assets", and returns the paths of the entries matching the filter.
+// It works on any fs.FS, like an embed.FS, a zip.Reader or os.DirFS, and accepts the same filter functions
+// as the other scans since os.DirEntry is fs.DirEntry; filters that only look at the entry, like FilterFile
+// or FilterByExtension, behave as usual, but those opening the path on the real filesystem, like FilterOpenable
+// or FilterText, don't.
+// Paths always use forward slashes, whatever the operating system, and are joined to root like fs.WalkDir does,
+// so they can be passed back to fsys. Symbolic links are reported but never followed, and embed.FS has none.
+// The traversal is serial, in lexical order, and continues past unreadable directories, returning the first error.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanFS(fsys fs.FS, root string, maxDepth int, filter func(string, fs.DirEntry) bool) ([]string, error) {
+	r := make([]string, 0)
+	var ferr error
+
+	err := fs.WalkDir(fsys, root, func(p string, de fs.DirEntry, err error) error {
+		if err != nil {
+			if ferr == nil {
+				ferr = err
+			}
+			return nil
+		}
+		if p == root {
+			return nil
+		}
+
+		if filter == nil || filter(p, de) {
+			r = append(r, p)
+		}
+		if de.IsDir() && maxDepth >= 0 && fsDepth(root, p) >= maxDepth {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if ferr == nil {
+		ferr = err
+	}
+	return r, ferr
+}
+
+// fsDepth returns the depth of the io/fs path p below root, 0 for the entries directly under it.
+func fsDepth(root string, p string) int {
+	if root != "." {
+		p = p[len(root)+1:]
+	}
+	return strings.Count(p, "/")
+}
@@ -0,0 +1,134 @@
+package scanner
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// ignoreRule is a pattern read from a .gitignore file.
+type ignoreRule struct {
+	// base is the directory holding the .gitignore file, patterns are relative to it.
+	base string
+	// pattern is a doublestar pattern matched against the slash separated path relative to base.
+	pattern string
+	// negate re-includes the entries matching pattern, for lines starting with !.
+	negate bool
+	// dirOnly restricts the rule to directories, for lines ending with /.
+	dirOnly bool
+}
+
+// readGitignore returns the rules of the .gitignore file in dir, none if it can't be read.
+func readGitignore(dir string) []ignoreRule {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var rules []ignoreRule
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		l := strings.TrimRight(sc.Text(), " \t\r")
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		r := ignoreRule{base: dir}
+		if strings.HasPrefix(l, "!") {
+			r.negate = true
+			l = l[1:]
+		} else if strings.HasPrefix(l, `\!`) || strings.HasPrefix(l, `\#`) {
+			l = l[1:]
+		}
+		if strings.HasSuffix(l, "/") {
+			r.dirOnly = true
+			l = strings.TrimRight(l, "/")
+		}
+		if l == "" {
+			continue
+		}
+		// A pattern without any slash but a trailing one matches at every level below base.
+		if strings.Contains(l, "/") {
+			l = strings.TrimPrefix(l, "/")
+		} else {
+			l = "**/" + l
+		}
+		if !doublestar.ValidatePattern(l) {
+			continue
+		}
+		r.pattern = l
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// gitignore returns a function reporting whether the entry at a path below root is ignored by the
+// .gitignore files of root and of the directories between root and the entry. The rules of each
+// directory are read once and cached; the function is safe for concurrent use.
+func gitignore(root string) func(string, os.DirEntry) bool {
+	root = filepath.Clean(root)
+	var cache sync.Map
+
+	// rules returns the rules applying to the entries of dir, those of the outermost directory first.
+	var rules func(dir string) []ignoreRule
+	rules = func(dir string) []ignoreRule {
+		if r, ok := cache.Load(dir); ok {
+			return r.([]ignoreRule)
+		}
+		var r []ignoreRule
+		if up := filepath.Dir(dir); dir != root && up != dir {
+			r = append(r, rules(up)...)
+		}
+		r = append(r, readGitignore(dir)...)
+		v, _ := cache.LoadOrStore(dir, r)
+		return v.([]ignoreRule)
+	}
+
+	return func(p string, de os.DirEntry) bool {
+		if de.IsDir() && de.Name() == ".git" {
+			return true
+		}
+		ignored := false
+		for _, r := range rules(filepath.Dir(p)) {
+			if ignored == !r.negate || (r.dirOnly && !de.IsDir()) {
+				continue
+			}
+			rel, err := filepath.Rel(r.base, p)
+			if err != nil {
+				continue
+			}
+			if ok, _ := doublestar.Match(r.pattern, filepath.ToSlash(rel)); ok {
+				ignored = !r.negate
+			}
+		}
+		return ignored
+	}
+}
+
+// ScanGitignore synchronously scans the directory structure starting at root path like ScanSync, skipping the
+// entries ignored by .gitignore files, like ripgrep and fd do. The .gitignore file of each directory applies to
+// everything below it, after the rules of the directories above it, and the last matching rule decides, so that
+// nested files and ! patterns can re-include entries. Ignored directories are not descended into, and the .git
+// directory is always skipped. Blank lines, # comments, *, ?, [...] and ** globs, leading / anchors and trailing /
+// for directories are supported; .gitignore files above root, .git/info/exclude and the global excludes file are not read.
+// The filter is only called for the entries that are not ignored.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanGitignore(root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) ([]string, error) {
+	s := newScanner(maxDepth, filter, opts)
+	kept := Not(gitignore(root))
+	if s.Filter != nil {
+		s.Filter = And(kept, s.Filter)
+	} else {
+		s.Filter = kept
+	}
+	if s.Descend != nil {
+		s.Descend = And(kept, s.Descend)
+	} else {
+		s.Descend = kept
+	}
+	return s.ScanSync(root)
+}
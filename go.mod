@@ -1,3 +1,8 @@
 module github.com/Tagliapietra96/scanner
 
 go 1.24.1
+
+require (
+	github.com/bmatcuk/doublestar/v4 v4.9.1
+	golang.org/x/sys v0.38.0
+)
@@ -27,6 +27,12 @@ func IsHidden(path string) bool {
 	return false
 }
 
+// IsHiddenEntry is like IsHidden for an entry read from a directory.
+// On Unix-like systems only the name matters, so it is the same as IsHidden.
+func IsHiddenEntry(path string, _ os.DirEntry) bool {
+	return IsHidden(path)
+}
+
 // ConfigDir returns the full config directory for the given application name
 // on Unix-like systems, using XDG_CONFIG_HOME or defaulting to $HOME/.config.
 func ConfigDir(dir string) (string, error) {
@@ -61,6 +67,30 @@ func CacheDir(dir string) (string, error) {
 	return filepath.Join(d, dir), nil
 }
 
+// StateDir returns the full state directory for the given application name
+// using XDG_STATE_HOME or defaulting to $HOME/.local/state.
+func StateDir(dir string) (string, error) {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(stateHome, dir), nil
+}
+
+// RuntimeDir returns the full runtime directory for the given application name, for sockets,
+// pid and lock files, using XDG_RUNTIME_DIR or defaulting to the OS temporary directory.
+func RuntimeDir(dir string) (string, error) {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = os.TempDir()
+	}
+	return filepath.Join(runtimeDir, dir), nil
+}
+
 // TempDir returns the OS temporary directory for the application
 func TempDir(dir string) string {
 	return filepath.Join(os.TempDir(), dir)
@@ -5,11 +5,17 @@ package scanner
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 )
 
 // IsHidden checks if the given path is a hidden file or directory.
+// Besides the hidden attribute, names starting with a dot are hidden, like on Unix-like systems,
+// so that dotfiles copied from them stay hidden.
 func IsHidden(path string) bool {
+	if strings.HasPrefix(filepath.Base(path), ".") {
+		return true
+	}
 	fileInfo, err := os.Stat(path)
 	if err != nil {
 		return false
@@ -21,6 +27,21 @@ func IsHidden(path string) bool {
 	return false
 }
 
+// IsHiddenEntry is like IsHidden for an entry read from a directory, but takes the attributes
+// from the entry, which already holds them, instead of calling os.Stat on the path.
+// Unlike IsHidden, the attributes of a symbolic link are those of the link itself.
+func IsHiddenEntry(path string, de os.DirEntry) bool {
+	if strings.HasPrefix(de.Name(), ".") {
+		return true
+	}
+	i, err := de.Info()
+	if err != nil {
+		return false
+	}
+	data, ok := i.Sys().(*syscall.Win32FileAttributeData)
+	return ok && data.FileAttributes&syscall.FILE_ATTRIBUTE_HIDDEN != 0
+}
+
 // ConfigDir returns the full config directory for the given application name
 // on Windows, using %AppData% (roaming).
 func ConfigDir(dir string) (string, error) {
@@ -55,6 +76,18 @@ func CacheDir(dir string) (string, error) {
 	return filepath.Join(d, dir), nil
 }
 
+// StateDir returns the full state directory for the given application name
+// on Windows, using %LocalAppData% like DataDir.
+func StateDir(dir string) (string, error) {
+	return DataDir(dir)
+}
+
+// RuntimeDir returns the full runtime directory for the given application name
+// on Windows, using the OS temporary directory.
+func RuntimeDir(dir string) (string, error) {
+	return TempDir(dir), nil
+}
+
 // TempDir returns the OS temporary directory for the application
 func TempDir(dir string) string {
 	return filepath.Join(os.TempDir(), dir)
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package scanner
+
+import "os"
+
+// inode returns 0 on systems without inode numbers, such as Windows.
+func inode(os.DirEntry) uint64 {
+	return 0
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package scanner
+
+import (
+	"os"
+	"syscall"
+)
+
+// inode returns the inode number of the entry, or 0 if its metadata can't be read.
+func inode(de os.DirEntry) uint64 {
+	i, err := de.Info()
+	if err != nil {
+		return 0
+	}
+	if st, ok := i.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
@@ -0,0 +1,33 @@
+//go:build unix
+
+package scanner_test
+
+import (
+	"os"
+	"slices"
+	"syscall"
+	"testing"
+
+	"github.com/Tagliapietra96/scanner"
+)
+
+func TestScanInodeOrder(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "c", "a", "d", "b")
+
+	r, err := scanner.ScanSync(root, 0, nil, scanner.WithInodeOrder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	inos := make([]uint64, 0, len(r))
+	for _, p := range r {
+		i, err := os.Lstat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inos = append(inos, i.Sys().(*syscall.Stat_t).Ino)
+	}
+	if len(r) != 4 || !slices.IsSorted(inos) {
+		t.Fatalf("expected 4 entries in inode order, got %v with inodes %v", r, inos)
+	}
+}
@@ -0,0 +1,82 @@
+package scanner
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// langProfiles maps ISO 639-1 codes to the most frequent character trigrams of the language,
+// most frequent first, with underscores standing for word boundaries.
+var langProfiles = map[string][]string{
+	"de": strings.Fields("en_ er_ _de der ch_ ie_ die _di ein und _un nd_ ich sch che cht den in_ ine _ei te_ gen ung ber _da ten es_ ter ste ist _ge"),
+	"en": strings.Fields("_th the he_ _an nd_ and _of of_ _to ed_ ing ng_ to_ _in er_ is_ ion tio on_ es_ ent _a_ at_ re_ _co hat tha _it for _wa was"),
+	"es": strings.Fields("_de de_ os_ la_ _la el_ _el es_ que _qu ue_ en_ ent as_ ion _co con ado nte aci cio ar_ _en los _lo del _pr ra_ _se _ha"),
+	"fr": strings.Fields("_de es_ de_ le_ _le ent ion _la la_ nt_ les _pa tio re_ que _qu ue_ ons des _et et_ ur_ ait men _co our eme _un _po _pr"),
+	"it": strings.Fields("_di di_ la_ _la che _ch he_ re_ to_ _co one ne_ ell del _de _in le_ lla zio ion ato per _pe nte ent _il il_ con gli _un"),
+	"nl": strings.Fields("en_ _de de_ an_ _va van et_ _he het er_ _en een _ee aar ing _in in_ ijk _ge ver _ve te_ ie_ _di die _da dat cht sch oor"),
+	"pt": strings.Fields("_de de_ os_ do_ _qu que ue_ ent da_ _co com ão_ ção _do es_ _da nte as_ ado _pa ara _se men _um um_ _pr ra_ _e_ _o_ em_"),
+}
+
+// minLangTrigrams is the number of trigrams a text needs for its language to be guessed.
+const minLangTrigrams = 50
+
+// trigrams counts the character trigrams of the words of b, lowercased and padded with an
+// underscore on both sides, the notation of langProfiles.
+func trigrams(b []byte) (map[string]int, int) {
+	tg := make(map[string]int)
+	n := 0
+	for _, w := range bytes.FieldsFunc(bytes.ToLower(b), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		rs := []rune("_" + string(w) + "_")
+		for i := 0; i+3 <= len(rs); i++ {
+			tg[string(rs[i:i+3])]++
+			n++
+		}
+	}
+	return tg, n
+}
+
+// detectLanguage guesses the language of b among langProfiles, scoring each language by how often
+// its trigrams occur in b, weighted by their rank. ok is false when b is too short or when the best
+// score doesn't beat the runner-up by 25%.
+func detectLanguage(b []byte) (lang string, ok bool) {
+	tg, n := trigrams(b)
+	if n < minLangTrigrams {
+		return "", false
+	}
+
+	var best, second int
+	for code, prof := range langProfiles {
+		score := 0
+		for r, g := range prof {
+			score += tg[g] * (len(prof) - r)
+		}
+		switch {
+		case score > best:
+			lang, best, second = code, score, best
+		case score > second:
+			second = score
+		}
+	}
+	return lang, best > 0 && best*4 >= second*5
+}
+
+// FilterByLanguage returns a filter function that matches text files written in the language
+// identified by the ISO 639-1 code langCode, compared case-insensitively.
+// It reads the first 8000 bytes of every regular file, skips binary ones like FilterText, and guesses
+// their language by comparing their character trigrams against built-in profiles of the most
+// common ones. The guess is a heuristic: short texts, texts mixing languages and source code are
+// often left undecided, and undecided files never match.
+// Supported codes are de, en, es, fr, it, nl and pt, other codes match nothing.
+func FilterByLanguage(langCode string) func(string, os.DirEntry) bool {
+	langCode = strings.ToLower(langCode)
+	return func(p string, de os.DirEntry) bool {
+		b, ok := readHead(p, de, sniffLen)
+		if !ok || bytes.IndexByte(b, 0) >= 0 {
+			return false
+		}
+		l, ok := detectLanguage(b)
+		return ok && l == langCode
+	}
+}
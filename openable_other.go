@@ -0,0 +1,20 @@
+//go:build !windows
+
+package scanner
+
+import "os"
+
+// FilterOpenable returns true for regular files that can currently be opened for reading.
+// It opens every regular file; Unix-like systems don't lock files against reading,
+// so only permissions can make it fail. Directories and other non regular entries return false.
+func FilterOpenable(p string, de os.DirEntry) bool {
+	if !de.Type().IsRegular() {
+		return false
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
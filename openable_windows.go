@@ -0,0 +1,30 @@
+//go:build windows
+
+package scanner
+
+import (
+	"os"
+	"syscall"
+)
+
+// FilterOpenable returns true for regular files that can currently be opened for reading.
+// It opens every regular file in shared read mode, so files locked exclusively by another
+// process are skipped before a content filter or the caller fails on them.
+// Directories and other non regular entries return false.
+func FilterOpenable(p string, de os.DirEntry) bool {
+	if !de.Type().IsRegular() {
+		return false
+	}
+	name, err := syscall.UTF16PtrFromString(p)
+	if err != nil {
+		return false
+	}
+	h, err := syscall.CreateFile(name, syscall.GENERIC_READ,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return false
+	}
+	syscall.CloseHandle(h)
+	return true
+}
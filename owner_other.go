@@ -0,0 +1,10 @@
+//go:build !unix
+
+package scanner
+
+import "os"
+
+// owner always reports false on systems without numeric user and group IDs, such as Windows.
+func owner(os.DirEntry) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,21 @@
+//go:build unix
+
+package scanner
+
+import (
+	"os"
+	"syscall"
+)
+
+// owner returns the user and group IDs owning the entry, ok is false if its metadata can't be read.
+func owner(de os.DirEntry) (uid, gid int, ok bool) {
+	i, err := de.Info()
+	if err != nil {
+		return 0, 0, false
+	}
+	st, ok := i.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
@@ -0,0 +1,45 @@
+//go:build unix
+
+package scanner_test
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Tagliapietra96/scanner"
+)
+
+func TestFilterByOwner(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a", "b")
+	expected := []string{filepath.Join(root, "a"), filepath.Join(root, "b")}
+
+	u, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, filter := range map[string]func(string, os.DirEntry) bool{
+		"uid":      scanner.FilterByOwner(os.Getuid()),
+		"gid":      scanner.FilterByGroup(os.Getgid()),
+		"username": scanner.FilterByOwnerName(u.Username),
+	} {
+		r, err := scanner.ScanSorted(root, 0, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(r, expected) {
+			t.Errorf("%s: expected %v, got %v", name, expected, r)
+		}
+	}
+
+	r, err := scanner.ScanSync(root, 0, scanner.FilterByOwner(os.Getuid()+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 0 {
+		t.Errorf("expected no entry owned by another user, got %v", r)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build darwin
+
+package scanner
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// FilterQuarantined returns true for entries carrying the com.apple.quarantine
+// extended attribute, which macOS sets on files downloaded from the internet
+// until the user approves them.
+func FilterQuarantined(p string, _ os.DirEntry) bool {
+	_, err := unix.Getxattr(p, "com.apple.quarantine", nil)
+	return err == nil
+}
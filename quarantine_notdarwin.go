@@ -0,0 +1,11 @@
+//go:build !darwin
+
+package scanner
+
+import "os"
+
+// FilterQuarantined returns true for entries carrying the com.apple.quarantine
+// extended attribute. The attribute only exists on macOS, so on other platforms it always returns false.
+func FilterQuarantined(_ string, _ os.DirEntry) bool {
+	return false
+}
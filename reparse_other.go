@@ -0,0 +1,10 @@
+//go:build !windows
+
+package scanner
+
+import "os"
+
+// FilterReparsePoint always returns false on Unix-like systems, which have no reparse points.
+func FilterReparsePoint(_ string, _ os.DirEntry) bool {
+	return false
+}
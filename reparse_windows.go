@@ -0,0 +1,21 @@
+//go:build windows
+
+package scanner
+
+import (
+	"os"
+	"syscall"
+)
+
+// FilterReparsePoint returns true for entries carrying FILE_ATTRIBUTE_REPARSE_POINT, such as symbolic
+// links, junctions and mount points. The attributes come from the directory listing, no extra system
+// call is needed. The traversal treats reparse points like symbolic links and only descends into
+// them when following is enabled, which avoids loops through junctions.
+func FilterReparsePoint(_ string, de os.DirEntry) bool {
+	i, err := de.Info()
+	if err != nil {
+		return false
+	}
+	data, ok := i.Sys().(*syscall.Win32FileAttributeData)
+	return ok && data.FileAttributes&syscall.FILE_ATTRIBUTE_REPARSE_POINT != 0
+}
@@ -2,93 +2,1399 @@
 package scanner
 
 import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"math"
+	"net"
 	"os"
+	"os/user"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// DefaultMaxSymlinkDepth is the number of symbolic links a single branch may follow
+// when Scanner.MaxSymlinkDepth is zero. It matches the ELOOP limit used by Linux.
+const DefaultMaxSymlinkDepth = 40
+
+// ErrTooManySymlinks is sent to the error channel when a branch of the traversal
+// would follow more symbolic links than allowed by Scanner.MaxSymlinkDepth.
+var ErrTooManySymlinks = errors.New("too many levels of symbolic links")
+
+// ErrSymlinkCycle is reported, when Scanner.ReportSymlinkCycles is set, for a symbolic link
+// that is not followed because it points to the directory holding it or to one of its ancestors.
+var ErrSymlinkCycle = errors.New("symbolic link cycle")
+
+// The errors below tell why a scan was aborted. When a scan stops early, the reason is sent once
+// to the error channel as its last error, so the sync variants return an error matching it with errors.Is.
+var (
+	// ErrCanceled reports that the context of the scan was canceled or its deadline exceeded.
+	// The abort error also wraps the cause of the context, like context.Canceled.
+	ErrCanceled = errors.New("scan canceled")
+	// ErrTooManyErrors reports that the scan encountered Scanner.MaxErrors errors.
+	ErrTooManyErrors = errors.New("too many errors")
+	// ErrByteBudgetExceeded reports that the matching files exceeded Scanner.MaxBytes.
+	ErrByteBudgetExceeded = errors.New("byte budget exceeded")
+	// ErrMaxDirsReached reports that the scan would have read more than Scanner.MaxDirs directories.
+	ErrMaxDirsReached = errors.New("maximum number of directories reached")
+	// ErrInsufficientSpace reports that the filesystem of the root had less than Scanner.MinFreeSpace
+	// bytes available, the scan doesn't start.
+	ErrInsufficientSpace = errors.New("insufficient free disk space")
 )
 
-// scan recursively traverses the directory structure starting at path p.
-// It respects the maximum depth m, applies the filter function fn to each entry,
-// and sends matching paths to rc and errors to ec. It manages concurrency internally.
+// ScanError is sent to the error channel when a directory of the traversal can't be read.
+// Path is the directory and Err the underlying error, which errors.Is and errors.As see through,
+// so that errors.Is(err, fs.ErrPermission) still holds for an unreadable directory.
+type ScanError struct {
+	Path string
+	Err  error
+}
+
+func (e *ScanError) Error() string {
+	return "scan " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *ScanError) Unwrap() error {
+	return e.Err
+}
+
+// Scanner holds the configuration of a directory traversal.
+// The package level functions build a Scanner from their arguments,
+// use it directly to enable the options they don't expose.
+type Scanner struct {
+	// MaxDepth is the maximum depth of the traversal.
+	// If MaxDepth is a negative value, it will traverse all levels of the directory tree.
+	MaxDepth int
+	// Filter is applied to each entry, only the entries it returns true for are reported.
+	// A nil Filter reports every entry. It only decides what is reported: a directory it
+	// rejects is still descended into, use Descend or FilterControlsDescent to prune the traversal.
+	Filter func(string, os.DirEntry) bool
+	// FilterControlsDescent makes Filter prune the traversal too, like find -prune: a directory it
+	// rejects is neither reported nor descended into, so nothing below it is reported even if it matches.
+	// Filters meant for files, like FilterFile or FilterByExtension, reject every directory and must not
+	// be combined with it. Descend, when set, still applies to the directories Filter accepts.
+	FilterControlsDescent bool
+	// Descend is applied to each directory, and to each symbolic link followed as one, within MaxDepth:
+	// only the directories it returns true for are descended into, whether Filter reports them or not.
+	// A nil Descend descends into every directory. MaxDepth takes precedence, Descend is not called
+	// for the directories at the maximum depth since they are never descended into.
+	Descend func(string, os.DirEntry) bool
+	// FollowSymlinks makes the traversal descend into symbolic links that point to directories.
+	// A link pointing to the directory holding it or to one of its ancestors, like a/link -> ..,
+	// would loop forever and is never followed, see ReportSymlinkCycles.
+	// On Windows, reparse points like junctions are treated as symbolic links: they are only
+	// descended into when following is enabled.
+	FollowSymlinks bool
+	// MaxSymlinkDepth is the number of symbolic links a single branch may follow when
+	// FollowSymlinks is enabled. A link past the limit is not followed and ErrTooManySymlinks
+	// is sent to the error channel instead. If zero, DefaultMaxSymlinkDepth is used.
+	MaxSymlinkDepth int
+	// SymlinkAllowlist restricts symbolic link following to the links whose resolved target lies
+	// within one of the listed directories, other links are not descended into. A non-empty list
+	// enables following on its own, without FollowSymlinks. MaxSymlinkDepth still applies.
+	SymlinkAllowlist []string
+	// ReportSymlinkCycles sends an error matching ErrSymlinkCycle for each symbolic link skipped
+	// because following it would loop. Cycles are silently skipped otherwise.
+	ReportSymlinkCycles bool
+	// Transform is applied to the path of each matching entry before it is reported.
+	// If it returns an empty string the entry is dropped from the results.
+	// It runs in the worker goroutines and must be safe for concurrent use.
+	Transform func(string) string
+	// RelativeBase makes the scanner report paths relative to it instead of the root,
+	// as computed by filepath.Rel on absolute paths. It is applied before Transform.
+	// If a path can't be made relative, it is reported as absolute and the error is sent to the error channel.
+	RelativeBase string
+	// Progress, when not nil, is atomically incremented for every entry the traversal visits,
+	// matching or not. Read it with atomic.LoadInt64 from another goroutine to poll the progress
+	// of the scan without any channel or allocation overhead.
+	Progress *int64
+	// Serial makes the traversal run depth-first on a single goroutine, so that entries are
+	// reported in a deterministic order: each directory right before its contents, and the entries
+	// of a directory in the order given by EntrySort.
+	Serial bool
+	// EntrySort orders the entries within each directory when Serial is enabled, it reports whether a
+	// must come before b. If nil, entries are ordered by name. It has no effect on concurrent traversals,
+	// whose order depends on scheduling.
+	EntrySort func(a, b os.DirEntry) bool
+	// SkipPaths lists paths excluded from the traversal: a directory in the list is neither reported
+	// nor descended into, a file in the list is not reported. Listing the root itself makes the scan
+	// report nothing. Paths are compared after filepath.Abs, which also cleans them.
+	SkipPaths []string
+	// MaxErrors aborts the scan with ErrTooManyErrors once that many errors have been reported.
+	// Zero means no limit.
+	MaxErrors int
+	// MaxBytes aborts the scan with ErrByteBudgetExceeded when the total size of the matching
+	// regular files would exceed it; the file crossing the budget is not reported. Zero means no limit.
+	MaxBytes int64
+	// MaxDirs aborts the scan with ErrMaxDirsReached when it would read more than that many
+	// directories, the root included. Zero means no limit.
+	MaxDirs int
+	// MinFreeSpace, when positive, checks the space available to the user on the filesystem of the root
+	// before starting and aborts with ErrInsufficientSpace if it is lower, so that tools processing the
+	// matched files don't fail midway on a full disk. If the space can't be read, the error is sent instead
+	// and the scan doesn't start either. The check is only supported on Linux, macOS and Windows,
+	// elsewhere it is skipped.
+	MinFreeSpace int64
+	// HashWorkers is the number of goroutines hashing files in the checksum based functions, like
+	// VerifyManifest. They run alongside the traversal goroutines, so that the I/O bound reading of
+	// directories and the CPU bound hashing have independent parallelism limits.
+	// If zero or negative, runtime.NumCPU() workers are used.
+	HashWorkers int
+	// DedupErrors reports each distinct error once: errors about entries of the same parent directory
+	// with the same underlying error, like permission denied on every subdirectory of a broken mount,
+	// are only sent the first time. Other errors are deduplicated when their messages are identical.
+	// Suppressed errors don't count toward MaxErrors.
+	DedupErrors bool
+	// Concurrency is the maximum number of directories read at the same time by concurrent traversals.
+	// If zero or negative, half the number of CPUs is used, at least one. It has no effect when Serial is set.
+	Concurrency int
+	// SkipErrors, when not nil, is called with each error of the traversal, like an unreadable directory,
+	// and the errors it returns true for are dropped silently, like find 2>/dev/null does: the traversal
+	// goes on with the rest of the tree either way. Skipped errors don't count toward MaxErrors and the
+	// errors telling why a scan was aborted are never skipped. It must be safe for concurrent use.
+	SkipErrors func(error) bool
+
+	// metrics, when not nil, is updated by the traversal, see ScanFull.
+	metrics *Metrics
+	// cacheInfo wraps each entry in an *Entry before any predicate sees it, see ScanEntries.
+	cacheInfo bool
+}
+
+// Option configures the Scanner used by the package level functions.
+type Option func(*Scanner)
+
+// WithFollowSymlinks makes the traversal descend into symbolic links that point to directories,
+// skipping those that would loop. See Scanner.FollowSymlinks.
+func WithFollowSymlinks() Option {
+	return func(s *Scanner) {
+		s.FollowSymlinks = true
+	}
+}
+
+// WithSymlinkAllowlist follows only the symbolic links resolving inside one of dirs.
+// See Scanner.SymlinkAllowlist.
+func WithSymlinkAllowlist(dirs []string) Option {
+	return func(s *Scanner) {
+		s.SymlinkAllowlist = dirs
+	}
+}
+
+// WithTransform sets the function applied to each matching path before it is reported.
+// Returning an empty string drops the entry. See Scanner.Transform.
+func WithTransform(fn func(string) string) Option {
+	return func(s *Scanner) {
+		s.Transform = fn
+	}
+}
+
+// WithRelativeBase makes the scanner report paths relative to base, independently from the root.
+// See Scanner.RelativeBase.
+func WithRelativeBase(base string) Option {
+	return func(s *Scanner) {
+		s.RelativeBase = base
+	}
+}
+
+// WithProgressCounter makes the scanner atomically increment *done for every visited entry.
+// Dividing it by the total returned by EstimateProgressTotal for the same scan gives a progress percentage.
+// See Scanner.Progress.
+func WithProgressCounter(done *int64) Option {
+	return func(s *Scanner) {
+		s.Progress = done
+	}
+}
+
+// WithSerial makes the scanner traverse the tree depth-first on a single goroutine.
+// See Scanner.Serial.
+func WithSerial() Option {
+	return func(s *Scanner) {
+		s.Serial = true
+	}
+}
+
+// WithEntrySort sets the order of the entries within each directory for serial traversals.
+// It has no effect unless the scanner is serial. See Scanner.EntrySort.
+func WithEntrySort(less func(a, b os.DirEntry) bool) Option {
+	return func(s *Scanner) {
+		s.EntrySort = less
+	}
+}
+
+// WithInodeOrder makes the traversal serial and orders the entries within each directory by inode number,
+// as a best-effort approximation of their creation order, which some forensic tools are after.
+// Only some filesystems hand out inode numbers increasingly (e.g. ext4 on a fresh directory),
+// others recycle freed numbers or derive them from hashes, and copies or restores from backups
+// renumber files: treat the order as a hint, not as evidence. On Windows, and for entries whose
+// metadata can't be read, every inode number is 0 and the name order is kept.
+func WithInodeOrder() Option {
+	return func(s *Scanner) {
+		s.Serial = true
+		s.EntrySort = func(a, b os.DirEntry) bool {
+			return inode(a) < inode(b)
+		}
+	}
+}
+
+// RequireFreeSpace aborts the scan with ErrInsufficientSpace before it starts if the filesystem
+// of the root has less than bytes available. See Scanner.MinFreeSpace.
+func RequireFreeSpace(bytes int64) Option {
+	return func(s *Scanner) {
+		s.MinFreeSpace = bytes
+	}
+}
+
+// WithHashWorkers sets the number of goroutines hashing files in the checksum based functions.
+// See Scanner.HashWorkers.
+func WithHashWorkers(n int) Option {
+	return func(s *Scanner) {
+		s.HashWorkers = n
+	}
+}
+
+// WithDedupErrors reports errors sharing their parent directory and underlying error only once.
+// See Scanner.DedupErrors.
+func WithDedupErrors() Option {
+	return func(s *Scanner) {
+		s.DedupErrors = true
+	}
+}
+
+// WithSkipErrors drops the errors for which skip returns true. See Scanner.SkipErrors.
+func WithSkipErrors(skip func(error) bool) Option {
+	return func(s *Scanner) {
+		s.SkipErrors = skip
+	}
+}
+
+// WithConcurrency sets the maximum number of directories read at the same time, 1 reading them one
+// after the other, which avoids seek thrashing on spinning disks. See Scanner.Concurrency.
+func WithConcurrency(n int) Option {
+	return func(s *Scanner) {
+		s.Concurrency = n
+	}
+}
+
+// WithSkipPaths excludes the given files and directories from the traversal.
+// See Scanner.SkipPaths.
+func WithSkipPaths(paths ...string) Option {
+	return func(s *Scanner) {
+		s.SkipPaths = append(s.SkipPaths, paths...)
+	}
+}
+
+// WithEntryFilter sets the predicate deciding which entries are reported, replacing the filter
+// argument of the package level functions. See Scanner.Filter.
+func WithEntryFilter(filter func(string, os.DirEntry) bool) Option {
+	return func(s *Scanner) {
+		s.Filter = filter
+	}
+}
+
+// WithFilterControlsDescent makes the filter prune the directories it rejects instead of only
+// leaving them out of the results. See Scanner.FilterControlsDescent.
+func WithFilterControlsDescent() Option {
+	return func(s *Scanner) {
+		s.FilterControlsDescent = true
+	}
+}
+
+// WithDescendFilter sets the predicate deciding which directories are descended into,
+// independently from the ones reported. See Scanner.Descend.
+func WithDescendFilter(descend func(string, os.DirEntry) bool) Option {
+	return func(s *Scanner) {
+		s.Descend = descend
+	}
+}
+
+// newScanner returns a Scanner with the given maximum depth and filter, configured by opts.
+func newScanner(maxDepth int, filter func(string, os.DirEntry) bool, opts []Option) *Scanner {
+	s := &Scanner{MaxDepth: maxDepth, Filter: filter}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// realDir is the real path of a directory being traversed, linked to the one of its parent:
+// following the chain gives the ancestors of the directory, to detect symbolic link cycles.
+type realDir struct {
+	path string
+	up   *realDir
+}
+
+// child returns the realDir of the subdirectory name of d, which must not be a symbolic link.
+// It returns nil when d is nil, that is when real paths are not tracked.
+func (d *realDir) child(name string) *realDir {
+	if d == nil {
+		return nil
+	}
+	return &realDir{path: filepath.Join(d.path, name), up: d}
+}
+
+// contains reports whether p is the path of d or of one of its ancestors.
+func (d *realDir) contains(p string) bool {
+	for ; d != nil; d = d.up {
+		if d.path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// dirJob is a directory found by a concurrent traversal, waiting to be read.
+// depth is the depth of its entries and links counts the symbolic links followed to reach it.
+type dirJob struct {
+	path  string
+	depth int
+	links int
+	rd    *realDir
+}
+
+// dirQueue is the work queue of a concurrent traversal: the directories found are pushed to it and
+// read by a pool of at most limit worker goroutines, started as needed, so that the number of goroutines
+// stays bounded by the concurrency whatever the shape of the tree; a queued directory only costs a dirJob.
+// The jobs are taken last in first out, depth first, which keeps the queue short on wide trees.
+type dirQueue struct {
+	mu   sync.Mutex
+	cond sync.Cond
+	jobs []dirJob
+	// pending counts the directories queued or being read, the root included, the workers
+	// return when it drops to zero.
+	pending int
+	// workers counts the started workers and idle those waiting for a job.
+	workers int
+	idle    int
+	limit   int
+	wg      sync.WaitGroup
+	read    func(dirJob)
+}
+
+// newDirQueue returns a queue calling read for each job. The root is counted as pending and read
+// outside of the pool, by the caller, so only limit-1 workers are started until rootDone is called.
+func newDirQueue(limit int, read func(dirJob)) *dirQueue {
+	q := &dirQueue{pending: 1, limit: limit - 1, read: read}
+	q.cond.L = &q.mu
+	return q
+}
+
+// push queues j, starting a worker if the limit allows.
+func (q *dirQueue) push(j dirJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.jobs = append(q.jobs, j)
+	q.pending++
+	q.start()
+	q.cond.Signal()
+}
+
+// start starts workers while the limit allows and more jobs are waiting than idle workers. q.mu must be held.
+func (q *dirQueue) start() {
+	for q.workers < q.limit && len(q.jobs) > q.idle {
+		q.workers++
+		q.wg.Add(1)
+		go q.work()
+	}
+}
+
+// work reads the queued directories until none is pending.
+func (q *dirQueue) work() {
+	defer q.wg.Done()
+	for {
+		q.mu.Lock()
+		for len(q.jobs) == 0 && q.pending > 0 {
+			q.idle++
+			q.cond.Wait()
+			q.idle--
+		}
+		if len(q.jobs) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		j := q.jobs[len(q.jobs)-1]
+		q.jobs = q.jobs[:len(q.jobs)-1]
+		q.mu.Unlock()
+
+		q.read(j)
+		q.done()
+	}
+}
+
+// done records that a directory has been read, waking the workers up when it was the last one.
+func (q *dirQueue) done() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending--; q.pending == 0 {
+		q.cond.Broadcast()
+	}
+}
+
+// rootDone records that the root has been read, lets the pool use the slot of the root,
+// and waits for the workers to read every queued directory.
+func (q *dirQueue) rootDone() {
+	q.mu.Lock()
+	q.limit++
+	q.start()
+	q.mu.Unlock()
+	q.done()
+	q.wg.Wait()
+}
+
+// scan recursively traverses the directory structure starting at path p.
+// It respects the maximum depth, applies the filter function to each entry and the descend
+// function to each directory, and calls visit for every matching entry and sends errors to ec.
+// It manages concurrency internally.
+// visit receives the depth of the entry, 0 for the entries directly under p, and is called
+// from multiple goroutines: it must be safe for concurrent use.
+// The traversal stops early when ctx is done or a limit is reached, and the reason is sent to ec.
+func (s *Scanner) scan(ctx context.Context, p string, visit func(string, os.DirEntry, int), ec chan<- error) {
+	parent := ctx
+	ctx, cancel := context.WithCancelCause(parent)
+	defer cancel(nil)
+
+	nc := s.Concurrency
+	if nc <= 0 {
+		nc = max(1, runtime.NumCPU()/2)
+	}
+	var nerrs, ndirs, nbytes atomic.Int64
+
+	ml := s.MaxSymlinkDepth
+	if ml == 0 {
+		ml = DefaultMaxSymlinkDepth
+	}
+
+	allow := make([]string, 0, len(s.SymlinkAllowlist))
+	for _, a := range s.SymlinkAllowlist {
+		if ab, err := filepath.Abs(a); err == nil {
+			if r, err := filepath.EvalSymlinks(ab); err == nil {
+				ab = r
+			}
+			allow = append(allow, ab)
+		}
+	}
+
+	// follow resolves the symbolic link at ep to the absolute path of its target,
+	// and reports whether it must be descended into.
+	follow := func(ep string) (string, bool) {
+		t, err := filepath.EvalSymlinks(ep)
+		if err != nil {
+			return "", false
+		}
+		if t, err = filepath.Abs(t); err != nil {
+			return "", false
+		}
+		if len(allow) == 0 {
+			return t, true
+		}
+		for _, a := range allow {
+			rel, err := filepath.Rel(a, t)
+			if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return t, true
+			}
+		}
+		return "", false
+	}
+
+	// report sends err to ec unless the scan is aborted or err is skipped or a duplicate, and enforces MaxErrors.
+	var seen sync.Map
+	report := func(err error) {
+		if ctx.Err() != nil {
+			return
+		}
+		if s.SkipErrors != nil && s.SkipErrors(err) {
+			return
+		}
+		if s.DedupErrors {
+			if _, dup := seen.LoadOrStore(errorSignature(err), true); dup {
+				return
+			}
+		}
+		ec <- err
+		if s.metrics != nil {
+			s.metrics.Errors.Add(1)
+		}
+		if n := nerrs.Add(1); s.MaxErrors > 0 && n >= int64(s.MaxErrors) {
+			cancel(ErrTooManyErrors)
+		}
+	}
+
+	base := s.RelativeBase
+	if base != "" {
+		if ab, err := filepath.Abs(base); err == nil {
+			base = ab
+		}
+	}
+
+	// result returns the path reported for the matching entry at ep,
+	// or an empty string if the entry must be dropped.
+	result := func(ep string) string {
+		if base != "" {
+			ab, err := filepath.Abs(ep)
+			if err == nil {
+				var rel string
+				if rel, err = filepath.Rel(base, ab); err == nil {
+					ab = rel
+				}
+			}
+			if err != nil {
+				report(err)
+			}
+			ep = ab
+		}
+		if s.Transform != nil {
+			return s.Transform(ep)
+		}
+		return ep
+	}
+
+	// budget reports whether the matching entry fits in MaxBytes, aborting the scan if it doesn't.
+	budget := func(de os.DirEntry) bool {
+		if (s.MaxBytes <= 0 && s.metrics == nil) || !de.Type().IsRegular() {
+			return true
+		}
+		i, err := de.Info()
+		if err != nil {
+			return true
+		}
+		if n := nbytes.Add(i.Size()); s.MaxBytes > 0 && n > s.MaxBytes {
+			cancel(ErrByteBudgetExceeded)
+			return false
+		}
+		if s.metrics != nil {
+			s.metrics.Bytes.Add(i.Size())
+		}
+		return true
+	}
+
+	var wd string
+	skip := make(map[string]bool, len(s.SkipPaths))
+	for _, sp := range s.SkipPaths {
+		if ab, err := filepath.Abs(sp); err == nil {
+			skip[ab] = true
+		}
+	}
+	if len(skip) > 0 {
+		wd, _ = os.Getwd()
+	}
+
+	// skipped reports whether the entry at ep is listed in SkipPaths.
+	skipped := func(ep string) bool {
+		if len(skip) == 0 {
+			return false
+		}
+		if !filepath.IsAbs(ep) {
+			ep = filepath.Join(wd, ep)
+		}
+		return skip[ep]
+	}
+
+	// d is the depth of the entries of pp and l counts the symbolic links followed to reach it.
+	var do func(string, int, int, *realDir)
+	q := newDirQueue(nc, func(j dirJob) { do(j.path, j.depth, j.links, j.rd) })
+	do = func(pp string, d int, l int, rd *realDir) {
+		if ctx.Err() != nil {
+			return
+		}
+		if n := ndirs.Add(1); s.MaxDirs > 0 && n > int64(s.MaxDirs) {
+			cancel(ErrMaxDirsReached)
+			return
+		}
+
+		des, err := os.ReadDir(pp)
+		if err != nil {
+			report(&ScanError{Path: pp, Err: err})
+			return
+		}
+		if s.metrics != nil {
+			s.metrics.Dirs.Add(1)
+		}
+		if s.Serial && s.EntrySort != nil {
+			slices.SortStableFunc(des, func(a, b os.DirEntry) int {
+				switch {
+				case s.EntrySort(a, b):
+					return -1
+				case s.EntrySort(b, a):
+					return 1
+				}
+				return 0
+			})
+		}
+
+		for _, de := range des {
+			if ctx.Err() != nil {
+				return
+			}
+			if s.Progress != nil {
+				atomic.AddInt64(s.Progress, 1)
+			}
+			if s.metrics != nil {
+				s.metrics.Entries.Add(1)
+			}
+
+			ep := filepath.Join(pp, de.Name())
+			if skipped(ep) {
+				continue
+			}
+			if s.cacheInfo {
+				de = &Entry{Path: ep, DirEntry: de}
+			}
+			if s.Filter == nil || s.Filter(ep, de) {
+				if !budget(de) {
+					return
+				}
+				if rp := result(ep); rp != "" {
+					if s.metrics != nil {
+						s.metrics.Matches.Add(1)
+					}
+					visit(rp, de, d)
+				}
+			} else if s.FilterControlsDescent {
+				continue
+			}
+			if s.MaxDepth >= 0 && d >= s.MaxDepth {
+				continue
+			}
+
+			ll, erd := l, (*realDir)(nil)
+			if link := de.Type()&os.ModeSymlink != 0 || (!de.Type().IsRegular() && FilterReparsePoint(ep, de)); link || !de.IsDir() {
+				if !link || rd == nil {
+					continue
+				}
+				i, err := os.Stat(ep)
+				if err != nil || !i.IsDir() {
+					continue
+				}
+				t, ok := follow(ep)
+				if !ok {
+					continue
+				}
+				if rd.contains(t) {
+					if s.ReportSymlinkCycles {
+						report(&fs.PathError{Op: "follow", Path: ep, Err: ErrSymlinkCycle})
+					}
+					continue
+				}
+				erd = &realDir{path: t, up: rd}
+				if ll++; ll > ml {
+					report(&fs.PathError{Op: "follow", Path: ep, Err: ErrTooManySymlinks})
+					continue
+				}
+			}
+			if s.Descend != nil && !s.Descend(ep, de) {
+				continue
+			}
+			if erd == nil {
+				erd = rd.child(de.Name())
+			}
+
+			// Directories with no depth left are read inline: their entries are never descended into,
+			// so handing them to a worker would cost more than reading them.
+			if s.Serial || (s.MaxDepth >= 0 && d+1 >= s.MaxDepth) {
+				do(ep, d+1, ll, erd)
+				continue
+			}
+			q.push(dirJob{path: ep, depth: d + 1, links: ll, rd: erd})
+		}
+	}
+
+	if s.MinFreeSpace > 0 {
+		n, err := freeSpace(p)
+		switch {
+		case errors.Is(err, errors.ErrUnsupported):
+		case err != nil:
+			ec <- err
+			return
+		case n < uint64(s.MinFreeSpace):
+			ec <- fmt.Errorf("%s: %d bytes available: %w", p, n, ErrInsufficientSpace)
+			return
+		}
+	}
+
+	// The root is read on the calling goroutine, workers are only started for the subdirectories
+	// to descend into past the next level: shallow scans (MaxDepth 0 or 1) and trees without
+	// subdirectories never start any.
+	// The real paths of the directories are only tracked when links are followed, to detect cycles.
+	var rd *realDir
+	if s.FollowSymlinks || len(allow) > 0 {
+		rp, err := filepath.Abs(p)
+		if err == nil {
+			if t, err := filepath.EvalSymlinks(rp); err == nil {
+				rp = t
+			}
+		}
+		rd = &realDir{path: rp}
+	}
+	// A root listed in SkipPaths is skipped as a whole, like any other directory in the list.
+	if !skipped(p) {
+		do(p, 0, 0, rd)
+	}
+	q.rootDone()
+
+	if ctx.Err() != nil {
+		err := context.Cause(ctx)
+		if parent.Err() != nil && !errors.Is(err, ErrTooManyErrors) && !errors.Is(err, ErrByteBudgetExceeded) && !errors.Is(err, ErrMaxDirsReached) {
+			err = fmt.Errorf("%w: %w", ErrCanceled, err)
+		}
+		ec <- err
+	}
+}
+
+// errorSignature returns the key DedupErrors compares errors by: the parent directory of the path
+// and the innermost error for path errors, the message for the others.
+func errorSignature(err error) string {
+	var pe *fs.PathError
+	if !errors.As(err, &pe) {
+		return err.Error()
+	}
+	inner := pe.Err
+	for u := errors.Unwrap(inner); u != nil; u = errors.Unwrap(u) {
+		inner = u
+	}
+	return fmt.Sprintf("%s\x00%T\x00%v", filepath.Dir(pe.Path), inner, inner)
+}
+
+// RichMatch is a matching entry sent by ScanRich, carrying everything the traversal knows about it.
+type RichMatch struct {
+	// Path is the path of the entry, as ScanSync would report it (after RelativeBase and Transform).
+	Path string
+	// Depth is the depth of the entry, 0 for the entries directly under the root.
+	Depth int
+	// Entry is the directory entry read from the parent directory. It is never nil and calling its
+	// methods costs no system call, except for Info which may need one depending on the platform.
+	Entry os.DirEntry
+}
+
+// Entry is a matching entry sent by ScanEntries. It is an os.DirEntry whose Info method calls the one
+// of the wrapped entry only once, then returns the same FileInfo and error, so that the filters and the
+// code receiving the entry share a single system call. The filters already receive the *Entry.
+type Entry struct {
+	// Path is the path of the entry, as ScanSync would report it (after RelativeBase and Transform).
+	Path string
+	os.DirEntry
+
+	once sync.Once
+	info fs.FileInfo
+	err  error
+}
+
+// Info returns the FileInfo of the entry, calling the Info method of the wrapped entry on the first call only.
+// It is safe for concurrent use.
+func (e *Entry) Info() (fs.FileInfo, error) {
+	e.once.Do(func() {
+		e.info, e.err = e.DirEntry.Info()
+	})
+	return e.info, e.err
+}
+
+// Metrics holds counters a traversal started by ScanFull updates while it runs.
+// They can be read at any time from any goroutine, and are final once the channels are closed.
+type Metrics struct {
+	// Entries is the number of entries visited, matching or not.
+	Entries atomic.Int64
+	// Matches is the number of entries sent to the match channel.
+	Matches atomic.Int64
+	// Dirs is the number of directories read, the root included.
+	Dirs atomic.Int64
+	// Bytes is the total size of the regular files accepted by the filter.
+	Bytes atomic.Int64
+	// Errors is the number of errors sent to the error channel, not counting the abort reason.
+	Errors atomic.Int64
+}
+
+// Scan asynchronously traverses the directory structure starting at root path
+// using the configuration of s. It sends matching paths to rc and errors to ec.
+// Both channels are closed when done.
+func (s *Scanner) Scan(root string, rc chan<- string, ec chan<- error) {
+	s.ScanContext(context.Background(), root, rc, ec)
+}
+
+// ScanContext is like Scan but stops the traversal as soon as ctx is done,
+// sending an error matching ErrCanceled and the context error to ec before closing both channels.
+func (s *Scanner) ScanContext(ctx context.Context, root string, rc chan<- string, ec chan<- error) {
+	go func() {
+		defer close(rc)
+		defer close(ec)
+		s.scan(ctx, root, func(p string, _ os.DirEntry, _ int) {
+			select {
+			case rc <- p:
+			case <-ctx.Done():
+			}
+		}, ec)
+	}()
+}
+
+// collect traverses the directory structure starting at root using the configuration of s and calls visit
+// for each matching entry with its depth, from the worker goroutines, until visit returns false.
+// With stop set, the traversal also stops at the first error and only that error is returned, otherwise
+// it goes on and every error encountered is returned. Either way, collect returns once the workers have,
+// and the cancellation of a traversal stopped by visit is not reported.
+func (s *Scanner) collect(ctx context.Context, root string, stop bool, visit func(string, os.DirEntry, int) bool) []error {
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ec := make(chan error)
+	go func() {
+		defer close(ec)
+		s.scan(sctx, root, func(p string, de os.DirEntry, d int) {
+			if !visit(p, de, d) {
+				cancel()
+			}
+		}, ec)
+	}()
+
+	var errs []error
+	for e := range ec {
+		if stop && len(errs) > 0 {
+			continue
+		}
+		// Otherwise sctx is only canceled by visit, and stopping on its request is no error.
+		if errors.Is(e, ErrCanceled) && sctx.Err() != nil && ctx.Err() == nil {
+			continue
+		}
+		errs = append(errs, e)
+		if stop {
+			cancel()
+		}
+	}
+	return errs
+}
+
+// firstError returns the first of errs, nil if there is none.
+func firstError(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs[0]
+}
+
+// ScanSync synchronously scans the directory structure starting at root path
+// using the configuration of s. It returns the matching paths and the first error encountered.
+// The traversal stops at that error, use ScanSyncPartial to collect every path and every error instead.
+func (s *Scanner) ScanSync(root string) ([]string, error) {
+	return s.ScanSyncContext(context.Background(), root)
+}
+
+// ScanSyncContext is like ScanSync but stops the traversal as soon as ctx is done,
+// returning an error matching ErrCanceled and the context error.
+// The traversal also stops at the first error. In both cases the paths matched
+// before it stopped are returned alongside the error, none is dropped.
+func (s *Scanner) ScanSyncContext(ctx context.Context, root string) ([]string, error) {
+	var mu sync.Mutex
+	r := make([]string, 0)
+	errs := s.collect(ctx, root, true, func(p string, _ os.DirEntry, _ int) bool {
+		mu.Lock()
+		r = append(r, p)
+		mu.Unlock()
+		return true
+	})
+	return r, firstError(errs)
+}
+
+// ScanSyncPartial synchronously scans the directory structure starting at root path
+// using the configuration of s. It never stops early: it returns every matching path
+// together with every error encountered. Matches are collected by the workers themselves
+// and errors are drained as they come, so a burst of errors never stalls the traversal.
+func (s *Scanner) ScanSyncPartial(root string) ([]string, []error) {
+	var mu sync.Mutex
+	r := make([]string, 0)
+	errs := s.collect(context.Background(), root, false, func(p string, _ os.DirEntry, _ int) bool {
+		mu.Lock()
+		r = append(r, p)
+		mu.Unlock()
+		return true
+	})
+	return r, errs
+}
+
+// ScanRich asynchronously traverses the directory structure starting at root path using the
+// configuration of s and sends every matching entry to the returned match channel, together with
+// its depth and directory entry, and errors to the returned error channel. Both channels are closed
+// when done and must be drained concurrently, like with Scan.
+func (s *Scanner) ScanRich(root string) (<-chan RichMatch, <-chan error) {
+	return s.ScanRichContext(context.Background(), root)
+}
+
+// ScanRichContext is like ScanRich but stops the traversal as soon as ctx is done,
+// sending an error matching ErrCanceled and the context error before closing both channels.
+func (s *Scanner) ScanRichContext(ctx context.Context, root string) (<-chan RichMatch, <-chan error) {
+	mc := make(chan RichMatch)
+	ec := make(chan error)
+	go func() {
+		defer close(mc)
+		defer close(ec)
+		s.scan(ctx, root, func(p string, de os.DirEntry, d int) {
+			select {
+			case mc <- RichMatch{Path: p, Depth: d, Entry: de}:
+			case <-ctx.Done():
+			}
+		}, ec)
+	}()
+	return mc, ec
+}
+
+// ScanFull is the entry point exposing every option at once: it traverses the directory structure starting
+// at root with the configuration of opts, streams each match with its path, depth and entry like ScanRich,
+// and keeps live Metrics about the traversal. The other scan functions are restricted forms of it.
+//
+// The options work together as follows:
+//   - ctx stops the traversal as soon as it is done, the abort error matches ErrCanceled and the context error.
+//   - MaxDepth bounds the traversal first: entries deeper than it are never visited, whatever the predicates say.
+//   - SkipPaths are left out before any predicate runs, directories included with their contents.
+//   - Filter decides what is sent to the match channel, Descend which directories are descended into;
+//     with FilterControlsDescent, the directories Filter rejects are not descended into either.
+//   - RelativeBase then Transform rewrite the paths of the matches, after Filter and the budget checks.
+//   - Concurrency bounds the directories read at the same time, Serial replaces it with a single goroutine.
+//   - MaxErrors, MaxBytes and MaxDirs abort the traversal, sending ErrTooManyErrors, ErrByteBudgetExceeded
+//     or ErrMaxDirsReached as the last error; MinFreeSpace prevents it from starting with ErrInsufficientSpace.
+//   - DedupErrors drops repeated errors before they count toward MaxErrors.
+//
+// Both channels are closed when done and must be drained concurrently, like with Scan.
+func ScanFull(ctx context.Context, opts Scanner, root string) (<-chan RichMatch, *Metrics, <-chan error) {
+	m := &Metrics{}
+	opts.metrics = m
+	mc, ec := opts.ScanRichContext(ctx, root)
+	return mc, m, ec
+}
+
+// Scan asynchronously traverses the directory structure starting at root path.
+// It respects the maximum depth, applies the filter function to each entry,
+// and sends matching paths to rc and errors to ec. Both channels are closed when done.
+// They can be buffered to let the workers run ahead of the consumer, see ScanBuffered.
+// Use ScanEntries to receive each match as an *Entry, its path with its os.DirEntry and cached Info,
+// instead of calling os.Lstat on the path, or ScanRich when the depth of each match is needed too.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func Scan(root string, maxDepth int, filter func(string, os.DirEntry) bool, rc chan<- string, ec chan<- error, opts ...Option) {
+	ScanContext(context.Background(), root, maxDepth, filter, rc, ec, opts...)
+}
+
+// ScanContext is like Scan but stops the traversal as soon as ctx is done: no directory is read and
+// no path is sent past that point, and the running workers return instead of finishing the tree.
+// The error sent to ec once, before both channels are closed, matches ErrCanceled and ctx.Err() with errors.Is.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanContext(ctx context.Context, root string, maxDepth int, filter func(string, os.DirEntry) bool, rc chan<- string, ec chan<- error, opts ...Option) {
+	newScanner(maxDepth, filter, opts).ScanContext(ctx, root, rc, ec)
+}
+
+// ScanWithConcurrency is like Scan but reads at most concurrency directories at the same time:
+// raise it for fast storage on many cores, lower it for spinning disks, 1 reading one directory
+// at a time. If concurrency is less than 1, half the number of CPUs is used, like for Scan.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanWithConcurrency(root string, maxDepth int, concurrency int, filter func(string, os.DirEntry) bool, rc chan<- string, ec chan<- error, opts ...Option) {
+	Scan(root, maxDepth, filter, rc, ec, append(opts, WithConcurrency(concurrency))...)
+}
+
+// ScanBuffered is like Scan but creates and returns the channels, with room for bufSize paths and bufSize
+// errors, closed when done. With unbuffered channels each worker waits for the consumer to take its path
+// before going on; a buffer lets the workers run ahead of a slow consumer, like one inserting into a database,
+// by up to bufSize paths, smoothing out bursts at the cost of holding them in memory. A buffer doesn't help
+// a consumer that is slower on average: once full, the workers wait again. Zero or a negative bufSize
+// makes unbuffered channels. Both channels must be drained concurrently, like with Scan.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanBuffered(root string, maxDepth int, bufSize int, filter func(string, os.DirEntry) bool, opts ...Option) (<-chan string, <-chan error) {
+	bufSize = max(bufSize, 0)
+	rc := make(chan string, bufSize)
+	ec := make(chan error, bufSize)
+	Scan(root, maxDepth, filter, rc, ec, opts...)
+	return rc, ec
+}
+
+// ScanSync synchronously scans the directory structure starting at root path.
+// It applies the filter function to each entry and returns a slice of matching paths.
+// It provides a shorthand to scan the directory tree without needing to manage channels.
+// it directly returns the results and errors.
+// The traversal stops at the first error, returned with the paths matched until then: when a few
+// unreadable directories must not void the rest of the scan, use ScanSyncPartial, which collects
+// every matching path and every error. Paths come in no particular order: use WithSerial or ScanSorted
+// for a deterministic one.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanSync(root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) ([]string, error) {
+	return newScanner(maxDepth, filter, opts).ScanSync(root)
+}
+
+// ScanProgress is like ScanSync but calls onProgress every interval with the number of entries visited so far,
+// matching or not, so that long scans can show how far they got, and once more with the final count when done.
+// The calls are made one at a time from a single goroutine, never from the workers, so onProgress needs no
+// locking but should return quickly: the count is sampled when it is called. An interval of zero or less
+// defaults to 100ms. A counter set with WithProgressCounter is replaced.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanProgress(root string, maxDepth int, filter func(string, os.DirEntry) bool, interval time.Duration, onProgress func(seen int64), opts ...Option) ([]string, error) {
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+	var seen int64
+	stop := make(chan struct{})
+	ticked := make(chan struct{})
+	go func() {
+		defer close(ticked)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				onProgress(atomic.LoadInt64(&seen))
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	r, err := ScanSync(root, maxDepth, filter, append(opts, WithProgressCounter(&seen))...)
+	close(stop)
+	<-ticked
+	onProgress(atomic.LoadInt64(&seen))
+	return r, err
+}
+
+// ScanSyncSkipErrors is like ScanSync but silently skips the permission errors, like find 2>/dev/null,
+// so that the traversal continues across the rest of the tree and returns every accessible match.
+// Other errors still stop it; use WithSkipErrors with ScanSync to choose the errors skipped.
 // If maxDepth is a negative value, it will traverse all levels of the directory tree.
-func scan(p string, m int, fn func(string, os.DirEntry) bool, rc chan<- string, ec chan<- error) {
-	var wg sync.WaitGroup
-	s := make(chan string, max(1, runtime.NumCPU()/2))
+func ScanSyncSkipErrors(root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) ([]string, error) {
+	return ScanSync(root, maxDepth, filter, append(opts, WithSkipErrors(func(err error) bool {
+		return errors.Is(err, fs.ErrPermission)
+	}))...)
+}
 
-	var do func(string, int)
-	do = func(pp string, mm int) {
-		defer wg.Done()
-		des, err := os.ReadDir(pp)
-		if err != nil {
-			ec <- err
-			return
+// ScanSorted is like ScanSync but returns the matching paths sorted, whatever the scheduling of the
+// concurrent traversal, which suits golden tests and printed listings. Paths are compared element by element,
+// so that each directory is directly followed by its contents: a, a/x, a-b rather than the lexical a, a-b, a/x.
+// This is also the order of a serial traversal, obtained without giving up concurrency.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanSorted(root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) ([]string, error) {
+	r, err := ScanSync(root, maxDepth, filter, opts...)
+	slices.SortFunc(r, comparePaths)
+	return r, err
+}
+
+// ScanAtDepth is like ScanSync but returns only the matching entries exactly depth levels below root,
+// 0 being the entries directly under it, leaving out the shallower ones ScanSync would return with
+// maxDepth set to depth. The traversal doesn't go deeper than depth. A negative depth matches nothing.
+func ScanAtDepth(root string, depth int, filter func(string, os.DirEntry) bool, opts ...Option) ([]string, error) {
+	r := make([]string, 0)
+	if depth < 0 {
+		return r, nil
+	}
+
+	var mu sync.Mutex
+	errs := newScanner(depth, filter, opts).collect(context.Background(), root, true, func(p string, _ os.DirEntry, d int) bool {
+		if d == depth {
+			mu.Lock()
+			r = append(r, p)
+			mu.Unlock()
 		}
+		return true
+	})
+	return r, firstError(errs)
+}
 
-		for _, de := range des {
-			if fn != nil && !fn(filepath.Join(pp, de.Name()), de) {
+// ScanRel is like ScanSync but returns the matching paths relative to root, as computed by filepath.Rel
+// on absolute paths, so that "." or a trailing separator on root make no difference and no path starts
+// with a separator. It is a shorthand for WithRelativeBase(root), which replaces any base set in opts.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanRel(root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) ([]string, error) {
+	return ScanSync(root, maxDepth, filter, append(opts, WithRelativeBase(root))...)
+}
+
+// comparePaths compares the paths a and b element by element, each element as a string.
+func comparePaths(a, b string) int {
+	for {
+		ea, ra, _ := strings.Cut(a, string(filepath.Separator))
+		eb, rb, _ := strings.Cut(b, string(filepath.Separator))
+		if c := strings.Compare(ea, eb); c != 0 {
+			return c
+		}
+		if ra == "" || rb == "" {
+			return cmp.Compare(len(ra), len(rb))
+		}
+		a, b = ra, rb
+	}
+}
+
+// ScanLimit is like ScanSync but stops the traversal as soon as limit matching paths have been found,
+// and returns them: the workers are canceled and have returned before ScanLimit does. Matches are found
+// concurrently, so which ones are returned varies between runs unless WithSerial is given, but never
+// more than limit are. If limit is zero or negative, the number of results is not limited.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanLimit(root string, maxDepth int, limit int, filter func(string, os.DirEntry) bool, opts ...Option) ([]string, error) {
+	if limit <= 0 {
+		return ScanSync(root, maxDepth, filter, opts...)
+	}
+
+	var mu sync.Mutex
+	r := make([]string, 0, limit)
+	errs := newScanner(maxDepth, filter, opts).collect(context.Background(), root, true, func(p string, _ os.DirEntry, _ int) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(r) < limit {
+			r = append(r, p)
+		}
+		return len(r) < limit
+	})
+	return r, firstError(errs)
+}
+
+// All returns an iterator over the paths matching the filter under root, for use with range:
+// the traversal runs as the loop consumes the paths, and breaking out of the loop stops it, the
+// workers having returned before the loop ends. Errors are skipped, the traversal going on past
+// them; use AllErr to receive them too.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func All(root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for p, err := range AllErr(root, maxDepth, filter, opts...) {
+			if err != nil {
 				continue
 			}
+			if !yield(p) {
+				return
+			}
+		}
+	}
+}
+
+// AllErr is like All but also yields each error encountered, with an empty path, in the order they occur.
+// The traversal goes on past errors; break out of the loop to stop at the first one.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func AllErr(root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		rc := make(chan string)
+		ec := make(chan error)
+		ScanContext(ctx, root, maxDepth, filter, rc, ec, opts...)
 
-			rc <- filepath.Join(pp, de.Name())
-			if mm != 0 && de.IsDir() {
-				wg.Add(1)
-				go func() {
-					s <- ""
-					defer func() { <-s }()
-					do(filepath.Join(pp, de.Name()), mm-1)
-				}()
+		// Once the loop is broken, the channels are still drained until the workers have returned.
+		stopped := false
+		for rc != nil || ec != nil {
+			select {
+			case p, ok := <-rc:
+				if !ok {
+					rc = nil
+					continue
+				}
+				if !stopped && !yield(p, nil) {
+					stopped = true
+					cancel()
+				}
+			case err, ok := <-ec:
+				if !ok {
+					ec = nil
+					continue
+				}
+				if !stopped && !yield("", err) {
+					stopped = true
+					cancel()
+				}
 			}
 		}
 	}
+}
 
-	wg.Add(1)
-	s <- ""
-	go func() {
-		defer func() { <-s }()
-		do(p, m)
-	}()
+// ScanPrune synchronously scans the directory structure starting at root path with a single function
+// deciding both whether each entry is reported and, for directories, whether the traversal descends
+// into them, so that subtrees like .git or node_modules are pruned instead of only being left out
+// of the results. It sets Filter and Descend, see Scanner.Descend; the descend result is ignored for
+// files. fn is called again for the directories within maxDepth to decide on descent, so it must be
+// cheap and return the same answer for the same entry.
+// The traversal stops at the first error, returned with the paths matched until then, like with ScanSync.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanPrune(root string, maxDepth int, fn func(path string, de os.DirEntry) (match bool, descend bool), opts ...Option) ([]string, error) {
+	s := newScanner(maxDepth, func(p string, de os.DirEntry) bool {
+		match, _ := fn(p, de)
+		return match
+	}, opts)
+	s.Descend = func(p string, de os.DirEntry) bool {
+		_, descend := fn(p, de)
+		return descend
+	}
+	return s.ScanSync(root)
+}
 
-	wg.Wait()
+// Walk synchronously scans the directory structure starting at root path and calls fn for each
+// matching entry, like filepath.WalkDir does, without any channel to manage. The traversal is still
+// concurrent, but the calls to fn are serialized, so fn needs no locking of its own; their order varies
+// between runs unless WithSerial is given. If fn returns an error the traversal stops, fn isn't called
+// again and Walk returns that error once the workers have returned.
+// Otherwise the traversal stops at the first error encountered, which is returned, like with ScanSync.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func Walk(root string, maxDepth int, filter func(string, os.DirEntry) bool, fn func(path string, de os.DirEntry) error, opts ...Option) error {
+	var mu sync.Mutex
+	var ferr error
+	errs := newScanner(maxDepth, filter, opts).collect(context.Background(), root, true, func(p string, de os.DirEntry, _ int) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if ferr == nil {
+			ferr = fn(p, de)
+		}
+		return ferr == nil
+	})
+	if ferr != nil {
+		return ferr
+	}
+	return firstError(errs)
 }
 
-// Scan asynchronously traverses the directory structure starting at root path.
-// It respects the maximum depth, applies the filter function to each entry,
-// and sends matching paths to rc and errors to ec. Both channels are closed when done.
+// ScanSyncPartial synchronously scans the directory structure starting at root path.
+// Unlike ScanSync it doesn't stop at the first error: it returns every matching path
+// together with every error encountered, so that unreadable directories don't void the rest of the scan.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanSyncPartial(root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) ([]string, []error) {
+	return newScanner(maxDepth, filter, opts).ScanSyncPartial(root)
+}
+
+// ScanMulti synchronously scans the directory structure starting at each of the roots, one after the other,
+// and returns the merged matching paths without duplicates, so that roots nested in one another or listed
+// twice report each entry once, under the first root that reached it. Paths are compared by their cleaned
+// absolute form. Like ScanSyncPartial, an unreadable directory doesn't stop the scan: every error
+// encountered under any root is returned joined with errors.Join, nil if there is none.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanMulti(roots []string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) ([]string, error) {
+	specs := make([]RootSpec, len(roots))
+	for i, root := range roots {
+		specs[i] = RootSpec{Path: root, MaxDepth: maxDepth}
+	}
+	return ScanRoots(specs, filter, opts...)
+}
+
+// RootSpec is a root scanned by ScanRoots with its own maximum depth.
+type RootSpec struct {
+	Path string
+	// MaxDepth is the maximum depth of the traversal of Path, a negative value traversing every level.
+	MaxDepth int
+}
+
+// ScanRoots is like ScanMulti but each root carries its own maximum depth, to scan src fully and vendor
+// only one level deep in a single call. The roots are scanned one after the other with the same options,
+// so they share the Concurrency limit instead of each running its own set of workers at the same time.
+// A path reached from two roots is reported once, under the first one, even if it's too deep for
+// the other, and every error is returned joined with errors.Join, like with ScanMulti.
+func ScanRoots(specs []RootSpec, filter func(string, os.DirEntry) bool, opts ...Option) ([]string, error) {
+	s := newScanner(-1, filter, opts)
+	r := make([]string, 0)
+	seen := make(map[string]bool)
+	var errs []error
+
+	for _, spec := range specs {
+		s.MaxDepth = spec.MaxDepth
+		ps, rerrs := s.ScanSyncPartial(spec.Path)
+		errs = append(errs, rerrs...)
+		for _, p := range ps {
+			k, err := filepath.Abs(p)
+			if err != nil {
+				k = filepath.Clean(p)
+			}
+			if !seen[k] {
+				seen[k] = true
+				r = append(r, p)
+			}
+		}
+	}
+	return r, errors.Join(errs...)
+}
+
+// ScanSyncJoinErrors is like ScanSyncPartial but returns every error encountered as a single error joined
+// with errors.Join, nil if there is none, which errors.Is and errors.As look into: the traversal doesn't stop
+// at the first error and no matching path is lost.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanSyncJoinErrors(root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) ([]string, error) {
+	r, errs := ScanSyncPartial(root, maxDepth, filter, opts...)
+	return r, errors.Join(errs...)
+}
+
+// ScanDirEntries synchronously scans the directory structure starting at root path and returns
+// the entries matching the filter as fs.DirEntry values, without any extra system call.
+// os.DirEntry is an alias of fs.DirEntry, so these are the very entries the filter received;
+// only their base name is available through Name, use ScanEntries when full paths are needed too.
+// The traversal runs to completion and the first error encountered is returned.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanDirEntries(root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) ([]fs.DirEntry, error) {
+	var mu sync.Mutex
+	r := make([]fs.DirEntry, 0)
+	err := newScanner(maxDepth, filter, opts).each(root, func(_ string, de os.DirEntry) {
+		mu.Lock()
+		r = append(r, de)
+		mu.Unlock()
+	})
+	return r, err
+}
+
+// ScanRich asynchronously scans the directory structure starting at root path and sends every entry
+// matching the filter to the returned match channel, with its path, depth and directory entry in
+// a single message, and errors to the returned error channel. Both channels are closed when done.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanRich(root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) (<-chan RichMatch, <-chan error) {
+	return newScanner(maxDepth, filter, opts).ScanRich(root)
+}
+
+// ScanEntries asynchronously scans the directory structure starting at root path and sends every entry
+// matching the filter to the returned entry channel as an *Entry, whose Info result is cached: the filters
+// receive the same *Entry, so that metadata read by a filter, like FilterBySize, is not read again downstream.
+// Errors are sent to the returned error channel. Both channels are closed when done and must be drained
+// concurrently, like with Scan.
 // If maxDepth is a negative value, it will traverse all levels of the directory tree.
-func Scan(root string, maxDepth int, filter func(string, os.DirEntry) bool, rc chan<- string, ec chan<- error) {
+func ScanEntries(root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) (<-chan *Entry, <-chan error) {
+	s := newScanner(maxDepth, filter, opts)
+	s.cacheInfo = true
+
+	rc := make(chan *Entry)
+	ec := make(chan error)
 	go func() {
 		defer close(rc)
 		defer close(ec)
-		scan(root, maxDepth, filter, rc, ec)
+		s.scan(context.Background(), root, func(p string, de os.DirEntry, _ int) {
+			e := de.(*Entry)
+			e.Path = p
+			rc <- e
+		}, ec)
 	}()
+	return rc, ec
 }
 
-// ScanSync synchronously scans the directory structure starting at root path.
-// It applies the filter function to each entry and returns a slice of matching paths.
-// It provides a shorthand to scan the directory tree without needing to manage channels.
-// it directly returns the results and errors.
-// If maxDepth is a negative value, it will traverse all levels of the directory tree.
-func ScanSync(root string, maxDepth int, filter func(string, os.DirEntry) bool) ([]string, error) {
-	rc := make(chan string)
-	ec := make(chan error)
-
-	go Scan(root, maxDepth, filter, rc, ec)
-	r := make([]string, 0)
+// And returns a filter function that matches the entries matched by every filter, with no filter matching everything.
+// Filters are evaluated in order and the evaluation stops at the first one rejecting the entry,
+// so cheap filters like FilterFile should come before expensive ones reading metadata or contents.
+func And(filters ...func(string, os.DirEntry) bool) func(string, os.DirEntry) bool {
+	return func(p string, de os.DirEntry) bool {
+		for _, f := range filters {
+			if !f(p, de) {
+				return false
+			}
+		}
+		return true
+	}
+}
 
-	for {
-		select {
-		case rs, ok := <-rc:
-			if !ok {
-				return r, nil
-			}
-			r = append(r, rs)
-		case err, ok := <-ec:
-			if !ok || err == nil {
-				continue
+// Or returns a filter function that matches the entries matched by any filter, with no filter matching nothing.
+// Filters are evaluated in order and the evaluation stops at the first one accepting the entry.
+func Or(filters ...func(string, os.DirEntry) bool) func(string, os.DirEntry) bool {
+	return func(p string, de os.DirEntry) bool {
+		for _, f := range filters {
+			if f(p, de) {
+				return true
 			}
-			return r, err
 		}
+		return false
+	}
+}
+
+// Not returns a filter function that matches the entries filter rejects.
+func Not(filter func(string, os.DirEntry) bool) func(string, os.DirEntry) bool {
+	return func(p string, de os.DirEntry) bool {
+		return !filter(p, de)
 	}
 }
 
@@ -103,9 +1409,9 @@ func FilterFile(_ string, de os.DirEntry) bool {
 }
 
 // FilterHidden returns true for entries that are hidden.
-// Uses IsHidden to check if the path is a hidden file or directory.
-func FilterHidden(p string, _ os.DirEntry) bool {
-	return IsHidden(p)
+// Uses IsHiddenEntry, which reads the attributes of the entry without an extra system call.
+func FilterHidden(p string, de os.DirEntry) bool {
+	return IsHiddenEntry(p, de)
 }
 
 // FilterRegular returns true only for regular file entries.
@@ -126,6 +1432,43 @@ func FilterSymlink(_ string, de os.DirEntry) bool {
 	return i.Mode()&os.ModeSymlink != 0
 }
 
+// FilterSymlinkToDir returns true only for symbolic links pointing to a directory.
+// It resolves the target with an extra os.Stat for every symbolic link, broken links return false.
+func FilterSymlinkToDir(p string, de os.DirEntry) bool {
+	if de.Type()&os.ModeSymlink == 0 {
+		return false
+	}
+	i, e := os.Stat(p)
+	if e != nil {
+		return false
+	}
+	return i.IsDir()
+}
+
+// FilterSymlinkToFile returns true only for symbolic links pointing to a regular file.
+// It resolves the target with an extra os.Stat for every symbolic link, broken links return false.
+func FilterSymlinkToFile(p string, de os.DirEntry) bool {
+	if de.Type()&os.ModeSymlink == 0 {
+		return false
+	}
+	i, e := os.Stat(p)
+	if e != nil {
+		return false
+	}
+	return i.Mode().IsRegular()
+}
+
+// FilterBrokenSymlink returns true only for symbolic links whose target can't be resolved,
+// because it doesn't exist, is unreachable or the links form a loop.
+// It resolves the target with an extra os.Stat for every symbolic link.
+func FilterBrokenSymlink(p string, de os.DirEntry) bool {
+	if de.Type()&os.ModeSymlink == 0 {
+		return false
+	}
+	_, e := os.Stat(p)
+	return e != nil
+}
+
 // FilterDevice returns true only for device file entries.
 func FilterDevice(_ string, de os.DirEntry) bool {
 	i, e := de.Info()
@@ -153,6 +1496,44 @@ func FilterSocket(_ string, de os.DirEntry) bool {
 	return i.Mode()&os.ModeSocket != 0
 }
 
+// socketDialTimeout bounds the connection attempts of FilterActiveSocket and FilterStaleSocket.
+const socketDialTimeout = 100 * time.Millisecond
+
+// dialSocket tries to connect to the Unix domain socket at p and reports whether a process accepted
+// the connection, or refused it because nothing listens on the socket anymore.
+func dialSocket(p string, de os.DirEntry) (live, refused bool) {
+	if de.Type()&os.ModeSocket == 0 {
+		return false, false
+	}
+	c, err := net.DialTimeout("unix", p, socketDialTimeout)
+	if err != nil {
+		return false, errors.Is(err, errConnRefused)
+	}
+	c.Close()
+	return true, false
+}
+
+// FilterActiveSocket returns true for Unix domain sockets a process is listening on.
+// It connects to every socket entry, waiting up to 100ms, and closes the connection right away:
+// the listening process sees a connection that sends nothing, which some servers log.
+// Only entries with the os.ModeSocket type are tried; sockets that can't be connected to
+// for other reasons, like permissions, return false.
+// Plan 9 has no Unix domain sockets, so it never matches there.
+func FilterActiveSocket(p string, de os.DirEntry) bool {
+	live, _ := dialSocket(p, de)
+	return live
+}
+
+// FilterStaleSocket returns true for Unix domain sockets nothing listens on anymore, which the
+// process that created them left behind and can safely be removed. Like FilterActiveSocket, it
+// connects to every socket entry: only refused connections match, not failures for other reasons.
+// It never matches on Windows, where a refused connection fails with WSAECONNREFUSED rather than
+// syscall.ECONNREFUSED, nor on Plan 9, which has no Unix domain sockets.
+func FilterStaleSocket(p string, de os.DirEntry) bool {
+	_, refused := dialSocket(p, de)
+	return refused
+}
+
 // FilterCharDev returns true only for character device entries.
 func FilterCharDev(_ string, de os.DirEntry) bool {
 	i, e := de.Info()
@@ -162,6 +1543,92 @@ func FilterCharDev(_ string, de os.DirEntry) bool {
 	return i.Mode()&os.ModeCharDevice != 0
 }
 
+// FilterByPermissions returns a filter function that matches entries whose permission bits,
+// masked with mask, equal expect. For example mask 0o002 and expect 0o002 match world-writable entries.
+func FilterByPermissions(mask os.FileMode, expect os.FileMode) func(string, os.DirEntry) bool {
+	return func(_ string, de os.DirEntry) bool {
+		i, e := de.Info()
+		if e != nil {
+			return false
+		}
+		return i.Mode().Perm()&mask == expect
+	}
+}
+
+// isEmpty reports whether the entry at p is an empty regular file or directory,
+// ok is false for the other entries and when it can't be read.
+// Directories are opened to read a single name.
+func isEmpty(p string, de os.DirEntry) (empty bool, ok bool) {
+	switch {
+	case de.Type().IsRegular():
+		i, err := de.Info()
+		if err != nil {
+			return false, false
+		}
+		return i.Size() == 0, true
+	case de.IsDir():
+		f, err := os.Open(p)
+		if err != nil {
+			return false, false
+		}
+		defer f.Close()
+		_, err = f.Readdirnames(1)
+		if errors.Is(err, io.EOF) {
+			return true, true
+		}
+		return false, err == nil
+	}
+	return false, false
+}
+
+// FilterEmpty returns true for empty regular files and directories without any entry.
+// It opens every directory it is called on to read a single name, an extra system call
+// per directory. Entries that can't be read and the other entry types return false.
+func FilterEmpty(p string, de os.DirEntry) bool {
+	empty, ok := isEmpty(p, de)
+	return ok && empty
+}
+
+// FilterNonEmpty returns true for non empty regular files and directories, the inverse of FilterEmpty.
+// It opens every directory it is called on like FilterEmpty, and returns false too for entries
+// that can't be read and for the other entry types.
+func FilterNonEmpty(p string, de os.DirEntry) bool {
+	empty, ok := isEmpty(p, de)
+	return ok && !empty
+}
+
+// FilterByOwner returns a filter function that matches entries owned by the user ID uid.
+// It never matches on systems without numeric user IDs, such as Windows.
+func FilterByOwner(uid int) func(string, os.DirEntry) bool {
+	return func(_ string, de os.DirEntry) bool {
+		u, _, ok := owner(de)
+		return ok && u == uid
+	}
+}
+
+// FilterByGroup returns a filter function that matches entries owned by the group ID gid.
+// It never matches on systems without numeric group IDs, such as Windows.
+func FilterByGroup(gid int) func(string, os.DirEntry) bool {
+	return func(_ string, de os.DirEntry) bool {
+		_, g, ok := owner(de)
+		return ok && g == gid
+	}
+}
+
+// FilterByOwnerName is like FilterByOwner for the user named username, looked up once when it is called.
+// An unknown user matches nothing.
+func FilterByOwnerName(username string) func(string, os.DirEntry) bool {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return func(string, os.DirEntry) bool { return false }
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return func(string, os.DirEntry) bool { return false }
+	}
+	return FilterByOwner(uid)
+}
+
 // FilterByExtension returns a filter function that matches files with the specified extension.
 // The extension can be provided with or without the leading dot.
 func FilterByExtension(e string) func(string, os.DirEntry) bool {
@@ -174,6 +1641,72 @@ func FilterByExtension(e string) func(string, os.DirEntry) bool {
 	}
 }
 
+// FilterByExtensionFold is like FilterByExtension but compares the extensions case-insensitively,
+// so that "jpg" matches .jpg, .JPG and .Jpg files. FilterByExtension keeps matching the exact case.
+func FilterByExtensionFold(e string) func(string, os.DirEntry) bool {
+	e = "." + strings.TrimPrefix(e, ".")
+	return func(p string, de os.DirEntry) bool {
+		return !de.IsDir() && strings.EqualFold(filepath.Ext(de.Name()), e)
+	}
+}
+
+// FilterByExtensions returns a filter function that matches files with any of the specified extensions,
+// each provided with or without the leading dot like for FilterByExtension.
+// Extensions are compared case-sensitively, see FilterByExtensionFold for folding case.
+func FilterByExtensions(exts ...string) func(string, os.DirEntry) bool {
+	set := make(map[string]bool, len(exts))
+	for _, e := range exts {
+		set["."+strings.TrimPrefix(e, ".")] = true
+	}
+	return func(_ string, de os.DirEntry) bool {
+		return !de.IsDir() && set[filepath.Ext(de.Name())]
+	}
+}
+
+// FilterByName returns a filter function that matches files and directories whose name matches
+// the shell pattern, with the syntax of filepath.Match (e.g. "*.log" or "report-??.csv").
+// A malformed pattern matches nothing.
+func FilterByName(pattern string) func(string, os.DirEntry) bool {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return func(string, os.DirEntry) bool { return false }
+	}
+	return func(_ string, de os.DirEntry) bool {
+		ok, _ := filepath.Match(pattern, de.Name())
+		return ok
+	}
+}
+
+// Exclude returns a filter function that rejects the entries whose name matches any of the shell patterns,
+// with the syntax of filepath.Match (e.g. "node_modules", ".git" or "*.tmp"), and accepts every other entry:
+// the inverse of FilterByName for several patterns. Malformed patterns are dropped when Exclude is called.
+// Used as Descend, with WithDescendFilter, it prunes the excluded directories; combine it with And to also
+// leave them out of the results.
+func Exclude(patterns ...string) func(string, os.DirEntry) bool {
+	valid := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err == nil {
+			valid = append(valid, pattern)
+		}
+	}
+	return func(_ string, de os.DirEntry) bool {
+		for _, pattern := range valid {
+			if ok, _ := filepath.Match(pattern, de.Name()); ok {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// FilterByRegex returns a filter function that matches entries whose full path, as passed to the filter,
+// matches re (e.g. `node_modules` or `\d{4}-\d{2}-\d{2}`). Paths use the separator of the
+// operating system. A *regexp.Regexp is safe for concurrent use, so the filter is too.
+func FilterByRegex(re *regexp.Regexp) func(string, os.DirEntry) bool {
+	return func(p string, _ os.DirEntry) bool {
+		return re.MatchString(p)
+	}
+}
+
 // FilterBySize returns a filter function that matches files based on their size.
 // The op parameter specifies the comparison operator ("<", "<=", ">", ">=", "=", "==", "!=").
 func FilterBySize(size int64, op string) func(string, os.DirEntry) bool {
@@ -183,22 +1716,229 @@ func FilterBySize(size int64, op string) func(string, os.DirEntry) bool {
 			return false
 		}
 
-		s := i.Size()
+		return compare(cmp.Compare(i.Size(), size), op)
+	}
+}
+
+// FilterByModTime returns a filter function that matches entries based on their modification time,
+// compared to t with the op parameter ("<", "<=", ">", ">=", "=", "==", "!=") like FilterBySize:
+// files older than 30 days are matched by FilterByModTime(time.Now().Add(-30*24*time.Hour), "<").
+// The resolution of modification times depends on the filesystem, from nanoseconds on ext4 or APFS
+// to 2 seconds on FAT, which matters for the equality operators.
+// Entries whose info can't be read return false.
+func FilterByModTime(t time.Time, op string) func(string, os.DirEntry) bool {
+	return func(_ string, de os.DirEntry) bool {
+		i, e := de.Info()
+		if e != nil {
+			return false
+		}
+		return compare(i.ModTime().Compare(t), op)
+	}
+}
+
+// FilterNewerThan returns a filter function that matches entries modified after the reference file at refPath,
+// like find -newer or the staleness check of make. The reference is read once, following symbolic links,
+// and an error is returned if it can't be. See FilterByModTime about the resolution of modification times.
+func FilterNewerThan(refPath string) (func(string, os.DirEntry) bool, error) {
+	i, err := os.Stat(refPath)
+	if err != nil {
+		return nil, err
+	}
+	return FilterByModTime(i.ModTime(), ">"), nil
+}
+
+// FilterOlderThan is like FilterNewerThan but matches entries modified before the reference file.
+func FilterOlderThan(refPath string) (func(string, os.DirEntry) bool, error) {
+	i, err := os.Stat(refPath)
+	if err != nil {
+		return nil, err
+	}
+	return FilterByModTime(i.ModTime(), "<"), nil
+}
+
+// compare reports whether the result c of a three-way comparison, negative, zero or positive,
+// satisfies the operator op ("<", "<=", ">", ">=", "=", "==", "!="). Unknown operators return false.
+func compare(c int, op string) bool {
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "=", "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	}
+	return false
+}
+
+// FilterByNameDate returns a filter function that matches entries whose name holds a date, written
+// with the Go time layout, that compares to t with the operator op ("<", "<=", ">", ">=", "=", "==", "!=").
+// The date may be anywhere in the name: substrings are tried from the left, the longest first at each
+// position, for every length the layout can render to, and the first one that parses is used, e.g.
+// "2006-01-02" finds 2024-01-15 in app-2024-01-15.log and "2006-1-2" finds 2024-10-5 in app-2024-10-5.log.
+// Dates without a zone are read in the location of t. Unlike FilterByModTime, the date survives copies
+// and restores, which makes it more reliable for retention policies on rotated logs.
+// Names without a parseable date return false.
+func FilterByNameDate(layout string, t time.Time, op string) func(string, os.DirEntry) bool {
+	lo, hi := layoutWidths(layout)
+	return func(_ string, de os.DirEntry) bool {
+		n := de.Name()
+		for i := 0; i+lo <= len(n); i++ {
+			for w := min(hi, len(n)-i); w >= lo; w-- {
+				if d, err := time.ParseInLocation(layout, n[i:i+w], t.Location()); err == nil {
+					return compare(d.Compare(t), op)
+				}
+			}
+		}
+		return false
+	}
+}
+
+// layoutWidths returns the shortest and longest lengths of the dates written with layout,
+// which vary with unpadded numbers, month and day names, fractional seconds and zones.
+func layoutWidths(layout string) (lo, hi int) {
+	lo = math.MaxInt
+	for _, loc := range []*time.Location{time.UTC, time.FixedZone("", -(3*60+30)*60)} {
+		for m := time.January; m <= time.December; m++ {
+			for _, d := range []time.Time{
+				time.Date(2001, m, 1, 1, 1, 1, 0, loc),
+				time.Date(2001, m, 28, 23, 59, 59, 123456789, loc),
+			} {
+				n := len(d.Format(layout))
+				lo, hi = min(lo, n), max(hi, n)
+			}
+		}
+	}
+	return lo, hi
+}
 
-		switch op {
-		case "<":
-			return s < size
-		case "<=":
-			return s <= size
-		case ">":
-			return s > size
-		case ">=":
-			return s >= size
-		case "=", "==":
-			return s == size
-		case "!=":
-			return s != size
+// FilterFutureModTime returns a filter function that matches entries modified after the current time
+// plus the tolerance, which often reveals clock skew, bad backup restores or tampering.
+// The current time is captured once when the filter is built, not for each entry.
+// Entries whose info can't be read return false.
+func FilterFutureModTime(tolerance time.Duration) func(string, os.DirEntry) bool {
+	limit := time.Now().Add(tolerance)
+	return func(_ string, de os.DirEntry) bool {
+		i, e := de.Info()
+		if e != nil {
+			return false
 		}
+		return i.ModTime().After(limit)
+	}
+}
+
+// FilterDoubleExtension returns true only for files whose last two extensions are the same,
+// like file.txt.txt or archive.zip.ZIP, a common result of buggy rename scripts.
+// Extensions are compared case-insensitively.
+func FilterDoubleExtension(_ string, de os.DirEntry) bool {
+	if de.IsDir() {
 		return false
 	}
+	parts := strings.Split(de.Name(), ".")
+	n := len(parts)
+	return n >= 3 && parts[n-1] != "" && strings.EqualFold(parts[n-1], parts[n-2])
+}
+
+// FilterParentNameMatch returns a filter function that matches entries whose immediate parent
+// directory name matches the pattern, using filepath.Match syntax (e.g. "v[0-9]*").
+// Only the direct parent is considered, not the other ancestors. An invalid pattern matches nothing.
+func FilterParentNameMatch(pattern string) func(string, os.DirEntry) bool {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return func(string, os.DirEntry) bool { return false }
+	}
+	return func(p string, _ os.DirEntry) bool {
+		ok, _ := filepath.Match(pattern, filepath.Base(filepath.Dir(p)))
+		return ok
+	}
+}
+
+// FilterByGlobPath returns a filter function that matches entries whose path relative to root
+// matches the pattern, with forward slashes as separators on every platform.
+// Besides the filepath.Match syntax, ** matches any number of directories, like in "src/**/*.go".
+// An invalid pattern matches nothing.
+func FilterByGlobPath(root, pattern string) func(string, os.DirEntry) bool {
+	return globPath(root, pattern, false)
+}
+
+// FilterByGlobPathInsensitive is like FilterByGlobPath but lowercases both the relative path
+// and the pattern before matching, following the semantics of case-insensitive filesystems like Windows.
+// On Unix, where names differing only by case are distinct entries, it matches more than
+// FilterByGlobPath: use it deliberately.
+func FilterByGlobPathInsensitive(root, pattern string) func(string, os.DirEntry) bool {
+	return globPath(root, pattern, true)
+}
+
+// globPath builds the filters of FilterByGlobPath and FilterByGlobPathInsensitive.
+func globPath(root, pattern string, fold bool) func(string, os.DirEntry) bool {
+	if fold {
+		pattern = strings.ToLower(pattern)
+	}
+	if !doublestar.ValidatePattern(pattern) {
+		return func(string, os.DirEntry) bool { return false }
+	}
+
+	return func(p string, _ os.DirEntry) bool {
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return false
+		}
+		rel = filepath.ToSlash(rel)
+		if fold {
+			rel = strings.ToLower(rel)
+		}
+		ok, _ := doublestar.Match(pattern, rel)
+		return ok
+	}
+}
+
+// FilterDirLargerThan returns a filter function that matches directories whose regular files
+// add up to more than n bytes, counting every level below them.
+// It runs a full traversal of each directory it is called on, so it is expensive:
+// combine it with a low maximum depth to avoid measuring the same subtrees over and over.
+// Directories that can't be fully read are measured on what could be read.
+func FilterDirLargerThan(n int64) func(string, os.DirEntry) bool {
+	return func(p string, de os.DirEntry) bool {
+		if !de.IsDir() {
+			return false
+		}
+
+		var t atomic.Int64
+		s := &Scanner{MaxDepth: -1}
+		s.each(p, func(_ string, de os.DirEntry) {
+			if !de.Type().IsRegular() {
+				return
+			}
+			if i, err := de.Info(); err == nil {
+				t.Add(i.Size())
+			}
+		})
+		return t.Load() > n
+	}
+}
+
+// FilterByPathLength returns a filter function that matches entries whose path is longer than n characters,
+// which break on systems with path length limits, like the 260 characters of Windows MAX_PATH or the 100 bytes
+// of the name field of old tar formats. The path is the one passed to the filter, joined to the root as given:
+// scan an absolute root to audit full paths. Characters are counted as runes, use len on the path for bytes.
+func FilterByPathLength(n int) func(string, os.DirEntry) bool {
+	return func(p string, _ os.DirEntry) bool {
+		return utf8.RuneCountInString(p) > n
+	}
+}
+
+// FilterSuspiciousName returns true for entries whose name contains a newline or another control character.
+// Such names break line based output and are a common trick to confuse scripts, which makes them worth auditing.
+func FilterSuspiciousName(_ string, de os.DirEntry) bool {
+	return strings.IndexFunc(de.Name(), unicode.IsControl) >= 0
+}
+
+// FilterInvalidUTF8Name returns true for entries whose name is not valid UTF-8,
+// typically written with a legacy encoding. Such names can't be stored as is in JSON or UTF-8 databases.
+func FilterInvalidUTF8Name(_ string, de os.DirEntry) bool {
+	return !utf8.ValidString(de.Name())
 }
@@ -1,9 +1,33 @@
 package scanner_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"embed"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"maps"
+	"math"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/Tagliapietra96/scanner"
 )
@@ -27,6 +51,21 @@ func compareSlices(a []string, b []string) []string {
 	return diff
 }
 
+// writeTree creates the given files under root, with their parent directories.
+// Paths ending with a slash are created as directories.
+func writeTree(t testing.TB, root string, paths ...string) {
+	t.Helper()
+	for _, p := range paths {
+		p = filepath.Join(root, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("0123456789"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkFilepathWalk(b *testing.B) {
 	for b.Loop() {
 		var fileCount int
@@ -147,3 +186,2569 @@ func TestScan(t *testing.T) {
 		t.Fatalf("Scanner found %d files, but filepath.WalkDir found %d files", lr, len(res))
 	}
 }
+
+func TestScanMaxSymlinkDepth(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "root")
+	for _, d := range []string{"root", "a", "b", "c"} {
+		if err := os.Mkdir(filepath.Join(tmp, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "c", "file"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// root/l1 -> a, a/l2 -> b, b/l3 -> c
+	for _, l := range [][2]string{{"a", "root/l1"}, {"b", "a/l2"}, {"c", "b/l3"}} {
+		if err := os.Symlink(filepath.Join(tmp, l[0]), filepath.Join(tmp, l[1])); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	deep := filepath.Join(root, "l1", "l2", "l3", "file")
+
+	s := &scanner.Scanner{MaxDepth: -1, FollowSymlinks: true}
+	r, err := s.ScanSync(root)
+	if err != nil {
+		t.Fatalf("Scanner failed: %v", err)
+	}
+	if !slices.Contains(r, deep) {
+		t.Fatalf("Scanner did not follow the symlink chain to %s, got %v", deep, r)
+	}
+
+	s.MaxSymlinkDepth = 2
+	r, err = s.ScanSync(root)
+	if !errors.Is(err, scanner.ErrTooManySymlinks) {
+		t.Fatalf("expected ErrTooManySymlinks, got %v", err)
+	}
+	if slices.Contains(r, deep) {
+		t.Fatalf("Scanner followed more than %d symlinks", s.MaxSymlinkDepth)
+	}
+}
+
+func TestFilterDoubleExtension(t *testing.T) {
+	root := t.TempDir()
+	names := []string{"file.txt.txt", "archive.zip.ZIP", "file.txt", "file.tar.gz", "txt.txt", "dots.."}
+	for _, n := range names {
+		if err := os.WriteFile(filepath.Join(root, n), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := scanner.ScanSync(root, 0, scanner.FilterDoubleExtension)
+	if err != nil {
+		t.Fatalf("Scanner failed: %v", err)
+	}
+	slices.Sort(r)
+	want := []string{filepath.Join(root, "archive.zip.ZIP"), filepath.Join(root, "file.txt.txt")}
+	if !slices.Equal(r, want) {
+		t.Fatalf("expected %v, got %v", want, r)
+	}
+}
+
+func TestFilterInvalidUTF8Name(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		t.Skip("filesystem requires valid UTF-8 names")
+	}
+
+	root := t.TempDir()
+	bad := filepath.Join(root, "caf\xe9.txt")
+	for _, p := range []string{bad, filepath.Join(root, "café.txt")} {
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := scanner.ScanSync(root, 0, scanner.FilterInvalidUTF8Name)
+	if err != nil {
+		t.Fatalf("Scanner failed: %v", err)
+	}
+	if len(r) != 1 || r[0] != bad {
+		t.Fatalf("expected only %q, got %q", bad, r)
+	}
+}
+
+func TestFilterSuspiciousName(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("filesystem rejects control characters in names")
+	}
+
+	root := t.TempDir()
+	names := []string{"new\nline", "tab\there", "esc\x1b[31m", "del\x7f", "clean name.txt"}
+	for _, n := range names {
+		if err := os.WriteFile(filepath.Join(root, n), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := scanner.ScanSorted(root, 0, scanner.FilterSuspiciousName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected []string
+	for _, n := range names[:4] {
+		expected = append(expected, filepath.Join(root, n))
+	}
+	slices.Sort(expected)
+	if !slices.Equal(r, expected) {
+		t.Fatalf("expected %q, got %q", expected, r)
+	}
+}
+
+func TestScanSerialEntrySort(t *testing.T) {
+	root := t.TempDir()
+	for _, p := range []string{"a/1", "a/2", "b/1"} {
+		p = filepath.Join(root, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	desc := func(a, b os.DirEntry) bool { return a.Name() > b.Name() }
+	r, err := scanner.ScanSync(root, -1, nil, scanner.WithSerial(), scanner.WithEntrySort(desc))
+	if err != nil {
+		t.Fatalf("Scanner failed: %v", err)
+	}
+
+	want := []string{"b", "b/1", "a", "a/2", "a/1"}
+	for i, w := range want {
+		want[i] = filepath.Join(root, w)
+	}
+	if !slices.Equal(r, want) {
+		t.Fatalf("expected %v, got %v", want, r)
+	}
+}
+
+func TestScanAbortReasons(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a/1", "a/2", "b/1", "c")
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		s := &scanner.Scanner{MaxDepth: -1}
+		_, err := s.ScanSyncContext(ctx, root)
+		if !errors.Is(err, scanner.ErrCanceled) || !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected ErrCanceled wrapping context.Canceled, got %v", err)
+		}
+	})
+
+	t.Run("max dirs", func(t *testing.T) {
+		s := &scanner.Scanner{MaxDepth: -1, MaxDirs: 1}
+		_, err := s.ScanSync(root)
+		if !errors.Is(err, scanner.ErrMaxDirsReached) {
+			t.Fatalf("expected ErrMaxDirsReached, got %v", err)
+		}
+	})
+
+	t.Run("byte budget", func(t *testing.T) {
+		s := &scanner.Scanner{MaxDepth: -1, MaxBytes: 25}
+		r, err := s.ScanSync(root)
+		if !errors.Is(err, scanner.ErrByteBudgetExceeded) {
+			t.Fatalf("expected ErrByteBudgetExceeded, got %v", err)
+		}
+		files := 0
+		for _, p := range r {
+			if i, err := os.Stat(p); err == nil && !i.IsDir() {
+				files++
+			}
+		}
+		if files > 2 {
+			t.Fatalf("reported %d files of 10 bytes with a budget of 25 bytes", files)
+		}
+	})
+
+	t.Run("insufficient space", func(t *testing.T) {
+		if runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "windows" {
+			t.Skip("free space check not supported")
+		}
+		r, err := scanner.ScanSync(root, -1, nil, scanner.RequireFreeSpace(math.MaxInt64))
+		if !errors.Is(err, scanner.ErrInsufficientSpace) || len(r) != 0 {
+			t.Fatalf("expected ErrInsufficientSpace and no results, got %v and %v", err, r)
+		}
+		if _, err := scanner.ScanSync(root, -1, nil, scanner.RequireFreeSpace(1)); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("too many errors", func(t *testing.T) {
+		tmp := t.TempDir()
+		writeTree(t, tmp, "root/f", "t1/f", "t2/f")
+		links := [][2]string{{"t1", "root/x"}, {"t2", "t1/y1"}, {"t2", "t1/y2"}, {"t2", "t1/y3"}}
+		for _, l := range links {
+			if err := os.Symlink(filepath.Join(tmp, l[0]), filepath.Join(tmp, l[1])); err != nil {
+				t.Skipf("symlinks not supported: %v", err)
+			}
+		}
+
+		s := &scanner.Scanner{MaxDepth: -1, FollowSymlinks: true, MaxSymlinkDepth: 1, MaxErrors: 2}
+		_, errs := s.ScanSyncPartial(filepath.Join(tmp, "root"))
+		if len(errs) != 3 {
+			t.Fatalf("expected 2 errors and the abort reason, got %v", errs)
+		}
+		if !errors.Is(errs[len(errs)-1], scanner.ErrTooManyErrors) {
+			t.Fatalf("expected ErrTooManyErrors as the last error, got %v", errs)
+		}
+	})
+}
+
+func TestScanSyncContextPartialResults(t *testing.T) {
+	root := t.TempDir()
+	var paths []string
+	for i := range 50 {
+		paths = append(paths, filepath.Join("d", strconv.Itoa(i)))
+	}
+	writeTree(t, root, paths...)
+
+	const n = 10
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var seen []string
+	s := &scanner.Scanner{MaxDepth: -1, Transform: func(p string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, p)
+		if len(seen) == n {
+			cancel()
+		}
+		return p
+	}}
+
+	r, err := s.ScanSyncContext(ctx, root)
+	if !errors.Is(err, scanner.ErrCanceled) {
+		t.Fatalf("expected ErrCanceled, got %v", err)
+	}
+	if len(r) < n {
+		t.Fatalf("expected at least %d results, got %d", n, len(r))
+	}
+	for _, p := range seen[:n] {
+		if !slices.Contains(r, p) {
+			t.Fatalf("result %s found before canceling is missing", p)
+		}
+	}
+}
+
+func TestFilterContainsAcrossChunks(t *testing.T) {
+	root := t.TempDir()
+	big := make([]byte, 40<<10)
+	for i := range big {
+		big[i] = 'x'
+	}
+	// The needle straddles the 32KiB chunk boundary.
+	copy(big[32<<10-3:], "NEEDLE")
+	if err := os.WriteFile(filepath.Join(root, "big.txt"), big, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "bin"), []byte("NEEDLE\x00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := scanner.ScanSync(root, 0, scanner.FilterContains("NEEDLE"))
+	if err != nil {
+		t.Fatalf("Scanner failed: %v", err)
+	}
+	if len(r) != 1 || filepath.Base(r[0]) != "big.txt" {
+		t.Fatalf("expected only big.txt, got %v", r)
+	}
+
+	r, err = scanner.ScanSync(root, 0, scanner.FilterContainsFold("needle"))
+	if err != nil {
+		t.Fatalf("Scanner failed: %v", err)
+	}
+	if len(r) != 1 || filepath.Base(r[0]) != "big.txt" {
+		t.Fatalf("expected only big.txt, got %v", r)
+	}
+}
+
+func TestScanSymlinkAllowlist(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, "root/f", "trusted/f", "untrusted/f")
+	for _, l := range [][2]string{{"trusted", "root/in"}, {"untrusted", "root/out"}} {
+		if err := os.Symlink(filepath.Join(tmp, l[0]), filepath.Join(tmp, l[1])); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	root := filepath.Join(tmp, "root")
+	r, err := scanner.ScanSync(root, -1, nil, scanner.WithSymlinkAllowlist([]string{filepath.Join(tmp, "trusted")}))
+	if err != nil {
+		t.Fatalf("Scanner failed: %v", err)
+	}
+	if !slices.Contains(r, filepath.Join(root, "in", "f")) {
+		t.Fatalf("allowed symlink was not followed: %v", r)
+	}
+	if slices.Contains(r, filepath.Join(root, "out", "f")) {
+		t.Fatalf("symlink outside the allowlist was followed: %v", r)
+	}
+}
+
+func TestScanSequenceGaps(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "frame_0001.png", "frame_0002.png", "frame_0005.png", "frame_7.png", "frame_x.png", "frame_0003.jpg", "sub/frame_0004.png")
+
+	missing, err := scanner.ScanSequenceGaps(root, "frame_{n}.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{3, 4, 6}; !slices.Equal(missing, expected) {
+		t.Fatalf("expected %v, got %v", expected, missing)
+	}
+
+	if _, err := scanner.ScanSequenceGaps(root, "frame.png"); err == nil {
+		t.Fatal("expected an error for a pattern without placeholder")
+	}
+
+	writeTree(t, root, "frame_20240115120000.png")
+	missing, err = scanner.ScanSequenceGaps(root, "frame_{n}.png")
+	if !errors.Is(err, scanner.ErrSequenceSpan) || missing != nil {
+		t.Fatalf("expected ErrSequenceSpan and no gap for a stray number, got %d gaps and %v", len(missing), err)
+	}
+}
+
+func TestScanDescend(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a/1", "a/b/2", "skip/3", "4")
+
+	r, err := scanner.ScanSync(root, -1, scanner.FilterFile, scanner.WithDescendFilter(func(p string, _ os.DirEntry) bool {
+		return filepath.Base(p) != "skip"
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(r)
+	expected := []string{filepath.Join(root, "4"), filepath.Join(root, "a", "1"), filepath.Join(root, "a", "b", "2")}
+	if !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+
+	notB := func(p string, _ os.DirEntry) bool { return filepath.Base(p) != "b" }
+	r, err = scanner.ScanSync(root, -1, notB, scanner.WithFilterControlsDescent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(r)
+	expected = []string{filepath.Join(root, "4"), filepath.Join(root, "a"), filepath.Join(root, "a", "1"), filepath.Join(root, "skip"), filepath.Join(root, "skip", "3")}
+	if !slices.Equal(r, expected) {
+		t.Fatalf("expected %v with the filter pruning, got %v", expected, r)
+	}
+}
+
+func TestScanSummary(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a.txt", "b.TXT", "sub/c.go", "sub/deep/README")
+	big := filepath.Join(root, "sub", "big.bin")
+	if err := os.WriteFile(big, make([]byte, 100), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	newest := filepath.Join(root, "a.txt")
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(newest, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	sm, err := scanner.ScanSummary(root, -1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sm.Files != 5 || sm.Dirs != 2 || sm.Bytes != 140 {
+		t.Fatalf("expected 5 files, 2 directories and 140 bytes, got %+v", sm)
+	}
+	if sm.Largest != big || sm.LargestSize != 100 {
+		t.Errorf("expected %s as the largest file, got %s (%d)", big, sm.Largest, sm.LargestSize)
+	}
+	if sm.Newest != newest || !sm.NewestTime.Equal(future) {
+		t.Errorf("expected %s as the newest file, got %s (%v)", newest, sm.Newest, sm.NewestTime)
+	}
+	if expected := map[string]int{".txt": 2, ".go": 1, ".bin": 1, "": 1}; !maps.Equal(sm.Extensions, expected) {
+		t.Errorf("expected extensions %v, got %v", expected, sm.Extensions)
+	}
+
+	sm, err = scanner.ScanSummary(root, 0, scanner.FilterRegular)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sm.Files != 2 || sm.Dirs != 0 || sm.Bytes != 20 {
+		t.Fatalf("expected the 2 files of the root only, got %+v", sm)
+	}
+}
+
+func TestScanGrowth(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "grown", "shrunk", "same", "sub/new")
+	p := func(n string) string { return filepath.Join(root, filepath.FromSlash(n)) }
+	previous := map[string]int64{p("grown"): 4, p("shrunk"): 20, p("same"): 10, p("sub"): 0, p("gone"): 1}
+
+	grown, err := scanner.ScanGrowth(root, -1, previous, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]int64{p("grown"): 6}; !maps.Equal(grown, expected) {
+		t.Fatalf("expected %v, got %v", expected, grown)
+	}
+}
+
+func TestDetectChanges(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "keep", "change", "remove", "sub/keep")
+
+	added, removed, modified, snap, err := scanner.DetectChanges(root, -1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 4 || len(removed) != 0 || len(modified) != 0 || len(snap) != 4 {
+		t.Fatalf("unexpected first run: added %v, removed %v, modified %v", added, removed, modified)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "change"), []byte("longer content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "remove")); err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, root, "sub/new")
+
+	added, removed, modified, _, err = scanner.DetectChanges(root, -1, snap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name     string
+		got      []string
+		expected string
+	}{
+		{"added", added, "sub/new"},
+		{"removed", removed, "remove"},
+		{"modified", modified, "change"},
+	} {
+		if !slices.Equal(c.got, []string{filepath.Join(root, filepath.FromSlash(c.expected))}) {
+			t.Errorf("expected %s %s, got %v", c.name, c.expected, c.got)
+		}
+	}
+}
+
+func TestDetectChangesUnreadable(t *testing.T) {
+	check := func(t *testing.T, root string, opts []scanner.Option, fail func(), unreadable string) {
+		t.Helper()
+		_, _, _, snap, err := scanner.DetectChanges(root, -1, nil, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := snap[unreadable]; !ok {
+			t.Fatalf("expected %s in the first snapshot", unreadable)
+		}
+		if err := os.Remove(filepath.Join(root, "remove")); err != nil {
+			t.Fatal(err)
+		}
+		fail()
+
+		added, removed, modified, next, err := scanner.DetectChanges(root, -1, snap, opts...)
+		if err == nil {
+			t.Fatal("expected the unreadable directory to be reported")
+		}
+		if expected := []string{filepath.Join(root, "remove")}; !slices.Equal(removed, expected) || len(added) != 0 || len(modified) != 0 {
+			t.Fatalf("expected only %v removed, got added %v, removed %v, modified %v", expected, added, removed, modified)
+		}
+		if st, ok := next[unreadable]; !ok || st != snap[unreadable] {
+			t.Fatalf("expected %s to be carried over, got %v", unreadable, next)
+		}
+	}
+
+	t.Run("permissions", func(t *testing.T) {
+		if runtime.GOOS == "windows" || os.Getuid() == 0 {
+			t.Skip("permissions are not enforced")
+		}
+		root := t.TempDir()
+		writeTree(t, root, "keep", "remove", "locked/y")
+		locked := filepath.Join(root, "locked")
+		t.Cleanup(func() { os.Chmod(locked, 0o755) })
+		check(t, root, nil, func() {
+			if err := os.Chmod(locked, 0); err != nil {
+				t.Fatal(err)
+			}
+		}, filepath.Join(locked, "y"))
+	})
+
+	// The root itself can't be read once moved away, whatever its spelling.
+	for name, sep := range map[string]string{"root": "", "root with a trailing separator": string(filepath.Separator)} {
+		t.Run(name, func(t *testing.T) {
+			tmp := t.TempDir()
+			root := filepath.Join(tmp, "root")
+			writeTree(t, root, "keep", "sub/file")
+
+			_, _, _, snap, err := scanner.DetectChanges(root+sep, -1, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Rename(root, filepath.Join(tmp, "moved")); err != nil {
+				t.Fatal(err)
+			}
+			added, removed, modified, next, err := scanner.DetectChanges(root+sep, -1, snap)
+			if err == nil {
+				t.Fatal("expected the missing root to be reported")
+			}
+			if len(added) != 0 || len(removed) != 0 || len(modified) != 0 || !maps.Equal(next, snap) {
+				t.Fatalf("expected the snapshot to be carried over, got added %v, removed %v, modified %v, %v", added, removed, modified, next)
+			}
+		})
+	}
+
+	t.Run("symlinks", func(t *testing.T) {
+		tmp := t.TempDir()
+		root := filepath.Join(tmp, "root")
+		writeTree(t, tmp, "root/keep", "root/remove", "b/file")
+		if err := os.Mkdir(filepath.Join(tmp, "a"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		// root/l1 -> a, a/l2 -> b
+		for _, l := range [][2]string{{"a", "root/l1"}, {"b", "a/l2"}} {
+			if err := os.Symlink(filepath.Join(tmp, l[0]), filepath.Join(tmp, l[1])); err != nil {
+				t.Skipf("symlinks not supported: %v", err)
+			}
+		}
+		// Lowering the limit makes root/l1/l2 impossible to follow on the second run.
+		limit := 0
+		opts := []scanner.Option{scanner.WithFollowSymlinks(), func(s *scanner.Scanner) { s.MaxSymlinkDepth = limit }}
+		check(t, root, opts, func() { limit = 1 }, filepath.Join(root, "l1", "l2", "file"))
+	})
+}
+
+func TestScanRich(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a/b/1", "2")
+
+	mc, ec := scanner.ScanRich(root, -1, nil)
+	depths := make(map[string]int)
+	for mc != nil || ec != nil {
+		select {
+		case m, ok := <-mc:
+			if !ok {
+				mc = nil
+				continue
+			}
+			if m.Entry == nil || m.Entry.Name() != filepath.Base(m.Path) {
+				t.Errorf("entry %v doesn't match path %s", m.Entry, m.Path)
+			}
+			rel, _ := filepath.Rel(root, m.Path)
+			depths[filepath.ToSlash(rel)] = m.Depth
+		case err, ok := <-ec:
+			if !ok {
+				ec = nil
+				continue
+			}
+			t.Error(err)
+		}
+	}
+
+	expected := map[string]int{"a": 0, "2": 0, "a/b": 1, "a/b/1": 2}
+	if !maps.Equal(depths, expected) {
+		t.Fatalf("expected depths %v, got %v", expected, depths)
+	}
+}
+
+func TestFilterByLanguage(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"en.txt":  "The quick brown fox jumps over the lazy dog. It was the best of times and the worst of times, and the people of the town were waiting for the end of the story to come.",
+		"it.txt":  "Nel mezzo del cammin di nostra vita mi ritrovai per una selva oscura, che la diritta via era smarrita. La storia della città e delle persone che ci vivono è lunga e complessa.",
+		"short":   "the end",
+		"bin.dat": "the quick brown fox jumps over the lazy dog and the cat\x00",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for lang, expected := range map[string]string{"en": "en.txt", "IT": "it.txt"} {
+		r, err := scanner.ScanSync(root, 0, scanner.FilterByLanguage(lang))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(r, []string{filepath.Join(root, expected)}) {
+			t.Errorf("expected %s for %s, got %v", expected, lang, r)
+		}
+	}
+}
+
+func TestAnyMatch(t *testing.T) {
+	root := t.TempDir()
+	var paths []string
+	for i := range 20 {
+		paths = append(paths, filepath.Join("d"+strconv.Itoa(i), "f"+strconv.Itoa(i)))
+	}
+	writeTree(t, root, paths...)
+
+	before := runtime.NumGoroutine()
+	ok, err := scanner.AnyMatch(root, -1, func(_ string, de os.DirEntry) bool { return de.Name() == "f7" })
+	if err != nil || !ok {
+		t.Fatalf("expected a match, got %v, %v", ok, err)
+	}
+	ok, err = scanner.AnyMatch(root, -1, func(_ string, de os.DirEntry) bool { return de.Name() == "missing" })
+	if err != nil || ok {
+		t.Fatalf("expected no match, got %v, %v", ok, err)
+	}
+
+	for i := 0; runtime.NumGoroutine() > before; i++ {
+		if i == 100 {
+			t.Fatalf("goroutines leaked: %d before, %d after", before, runtime.NumGoroutine())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func BenchmarkVerifyManifest(b *testing.B) {
+	root := b.TempDir()
+	data := bytes.Repeat([]byte("0123456789abcdef"), 16<<10)
+	var manifest strings.Builder
+	for i := range 64 {
+		rel := filepath.Join("d"+strconv.Itoa(i%8), "f"+strconv.Itoa(i))
+		p := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(p, data, 0o644); err != nil {
+			b.Fatal(err)
+		}
+		fmt.Fprintf(&manifest, "%s  %x\n", filepath.ToSlash(rel), sha256.Sum256(data))
+	}
+	mp := filepath.Join(b.TempDir(), "SHA256SUMS")
+	if err := os.WriteFile(mp, []byte(manifest.String()), 0o644); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, n := range []int{1, 4} {
+		b.Run("workers="+strconv.Itoa(n), func(b *testing.B) {
+			b.SetBytes(int64(64 * len(data)))
+			for b.Loop() {
+				ok, _, _, err := scanner.VerifyManifest(root, mp, "sha256", scanner.WithHashWorkers(n))
+				if err != nil || !ok {
+					b.Fatalf("manifest verification failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestScanMatchDirs(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a/x.go", "a/y.go", "b/c/z.go", "b/readme.md", "w.go")
+
+	r, err := scanner.ScanMatchDirs(root, -1, scanner.FilterByExtension(".go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{root, filepath.Join(root, "a"), filepath.Join(root, "b", "c")}
+	if !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestFilterByNameDate(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "app-2024-01-10.log", "app-2024-01-15.log", "app-2024-02-01.log", "app.log", "2024-13-01.log")
+
+	cut := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	for op, expected := range map[string][]string{
+		"<":  {"app-2024-01-10.log"},
+		"<=": {"app-2024-01-10.log", "app-2024-01-15.log"},
+		"==": {"app-2024-01-15.log"},
+		">":  {"app-2024-02-01.log"},
+	} {
+		r, err := scanner.ScanSync(root, 0, scanner.FilterByNameDate("2006-01-02", cut, op))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, p := range r {
+			names = append(names, filepath.Base(p))
+		}
+		slices.Sort(names)
+		if !slices.Equal(names, expected) {
+			t.Errorf("%s: expected %v, got %v", op, expected, names)
+		}
+	}
+}
+
+func TestFilterByNameDateUnpadded(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "app-2024-10-5.log", "app-2024-10-15.log", "app-2024-9-30.log", "app-2024-1-1.log")
+
+	cut := time.Date(2024, 10, 5, 0, 0, 0, 0, time.UTC)
+	for op, expected := range map[string][]string{
+		"<":  {"app-2024-1-1.log", "app-2024-9-30.log"},
+		"==": {"app-2024-10-5.log"},
+		">":  {"app-2024-10-15.log"},
+	} {
+		r, err := scanner.ScanSync(root, 0, scanner.FilterByNameDate("2006-1-2", cut, op))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, p := range r {
+			names = append(names, filepath.Base(p))
+		}
+		slices.Sort(names)
+		if !slices.Equal(names, expected) {
+			t.Errorf("%s: expected %v, got %v", op, expected, names)
+		}
+	}
+
+	// Month names vary in length too.
+	r, err := scanner.ScanSync(root, 0, scanner.FilterByNameDate("January 2", cut, "=="))
+	if err != nil || len(r) != 0 {
+		t.Fatalf("expected no match, got %v, %v", r, err)
+	}
+	writeTree(t, root, "report-September 3.txt")
+	r, err = scanner.ScanSync(root, 0, scanner.FilterByNameDate("January 2", time.Date(0, 9, 3, 0, 0, 0, 0, time.UTC), "=="))
+	if err != nil || !slices.Equal(r, []string{filepath.Join(root, "report-September 3.txt")}) {
+		t.Fatalf("expected the September report, got %v, %v", r, err)
+	}
+}
+
+func BenchmarkScanSyncShallow(b *testing.B) {
+	root := b.TempDir()
+	var paths []string
+	for i := range 200 {
+		paths = append(paths, "f"+strconv.Itoa(i), filepath.Join("d"+strconv.Itoa(i%20), "f"+strconv.Itoa(i)))
+	}
+	writeTree(b, root, paths...)
+
+	for _, d := range []int{0, 1} {
+		b.Run("maxDepth="+strconv.Itoa(d), func(b *testing.B) {
+			for b.Loop() {
+				if _, err := scanner.ScanSync(root, d, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestScanSyncLeafDirectories(t *testing.T) {
+	root := t.TempDir()
+	var paths []string
+	for i := range 30 {
+		paths = append(paths, filepath.Join("d"+strconv.Itoa(i%5), "e"+strconv.Itoa(i%3), "g", "f"+strconv.Itoa(i)))
+	}
+	writeTree(t, root, paths...)
+
+	// The directories at the depth limit are read inline rather than by the workers.
+	for _, d := range []int{1, 2} {
+		r, err := scanner.ScanSync(root, d, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := scanner.ScanSync(root, d, nil, scanner.WithSerial())
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(r)
+		slices.Sort(expected)
+		if !slices.Equal(r, expected) {
+			t.Fatalf("maxDepth %d: expected %v, got %v", d, expected, r)
+		}
+	}
+}
+
+func TestFilterByGlobPath(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "main.go", "src/a.go", "src/pkg/deep/b.go", "src/pkg/c.txt", "src/E.GO")
+
+	for _, c := range []struct {
+		filter   func(string, os.DirEntry) bool
+		expected []string
+	}{
+		{scanner.FilterByGlobPath(root, "src/**/*.go"), []string{"src/a.go", "src/pkg/deep/b.go"}},
+		{scanner.FilterByGlobPath(root, "*.go"), []string{"main.go"}},
+		{scanner.FilterByGlobPath(root, "src/[a"), nil},
+		{scanner.FilterByGlobPathInsensitive(root, "SRC/**/*.Go"), []string{"src/E.GO", "src/a.go", "src/pkg/deep/b.go"}},
+	} {
+		r, err := scanner.ScanSorted(root, -1, c.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var expected []string
+		for _, p := range c.expected {
+			expected = append(expected, filepath.Join(root, filepath.FromSlash(p)))
+		}
+		if !slices.Equal(r, expected) {
+			t.Errorf("expected %v, got %v", expected, r)
+		}
+	}
+}
+
+func TestFilterParentNameMatch(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "v1/a", "v2/sub/b", "v10/c", "other/d")
+
+	r, err := scanner.ScanSorted(root, -1, scanner.FilterParentNameMatch("v[0-9]*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// v2/sub/b has v2 as grandparent only.
+	expected := []string{filepath.Join(root, "v1", "a"), filepath.Join(root, "v10", "c"), filepath.Join(root, "v2", "sub")}
+	if !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+
+	if r, err = scanner.ScanSorted(root, -1, scanner.FilterParentNameMatch("v[")); err != nil || len(r) != 0 {
+		t.Fatalf("expected no match with an invalid pattern, got %v, %v", r, err)
+	}
+}
+
+func TestFilterFutureModTime(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "now", "soon", "later")
+	for name, d := range map[string]time.Duration{"soon": 30 * time.Second, "later": 2 * time.Hour} {
+		mt := time.Now().Add(d)
+		if err := os.Chtimes(filepath.Join(root, name), mt, mt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for tolerance, expected := range map[time.Duration][]string{
+		0:         {filepath.Join(root, "later"), filepath.Join(root, "soon")},
+		time.Hour: {filepath.Join(root, "later")},
+	} {
+		r, err := scanner.ScanSorted(root, 0, scanner.FilterFutureModTime(tolerance))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(r, expected) {
+			t.Errorf("tolerance %v: expected %v, got %v", tolerance, expected, r)
+		}
+	}
+}
+
+func TestFilterDirLargerThan(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "small/a", "big/a", "big/sub/b", "big/sub/c", "file")
+
+	r, err := scanner.ScanSync(root, 0, scanner.FilterDirLargerThan(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{filepath.Join(root, "big")}; !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+
+	r, err = scanner.ScanSync(root, -1, scanner.FilterDirLargerThan(9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(r)
+	if expected := []string{filepath.Join(root, "big"), filepath.Join(root, "big", "sub"), filepath.Join(root, "small")}; !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestFilterByPathLength(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "short", filepath.Join("dir", "long-name-é"))
+
+	n := len([]rune(filepath.Join(root, "dir", "long-name")))
+	r, err := scanner.ScanSync(root, -1, scanner.FilterByPathLength(n))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{filepath.Join(root, "dir", "long-name-é")}; !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestScanTree(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "b/x.go", "b/c/y.go", "b/c/z.txt", "a.go", "d/w.txt")
+
+	var sb strings.Builder
+	if err := scanner.ScanTree(&sb, root, -1, scanner.FilterByExtension(".go")); err != nil {
+		t.Fatal(err)
+	}
+	expected := root + `
+├── a.go
+└── b
+    ├── c
+    │   └── y.go
+    └── x.go
+`
+	if sb.String() != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, sb.String())
+	}
+}
+
+//go:embed testdata/fsys
+var embedded embed.FS
+
+func TestScanFS(t *testing.T) {
+	for _, c := range []struct {
+		root     string
+		maxDepth int
+		filter   func(string, os.DirEntry) bool
+		expected []string
+	}{
+		{"testdata/fsys", -1, nil, []string{"testdata/fsys/a.txt", "testdata/fsys/sub", "testdata/fsys/sub/b.txt", "testdata/fsys/sub/deep", "testdata/fsys/sub/deep/c.go"}},
+		{"testdata/fsys", 1, scanner.FilterFile, []string{"testdata/fsys/a.txt", "testdata/fsys/sub/b.txt"}},
+		{"testdata/fsys", -1, scanner.FilterByExtension(".go"), []string{"testdata/fsys/sub/deep/c.go"}},
+		{".", 1, scanner.FilterDir, []string{"testdata", "testdata/fsys"}},
+	} {
+		r, err := scanner.ScanFS(embedded, c.root, c.maxDepth, c.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(r, c.expected) {
+			t.Errorf("%s at depth %d: expected %v, got %v", c.root, c.maxDepth, c.expected, r)
+		}
+	}
+
+	if _, err := scanner.ScanFS(embedded, "missing", -1, nil); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+func TestScanSyncErrorBurst(t *testing.T) {
+	root := t.TempDir()
+	const n = 200
+	var paths []string
+	for i := range n {
+		paths = append(paths, filepath.Join("d"+strconv.Itoa(i), "locked", "f"))
+	}
+	writeTree(t, root, paths...)
+
+	// Every directory holds a link to itself, a cycle reported even when running as root.
+	// Unreadable directories add a second error each when permissions are enforced.
+	for i := range n {
+		d := filepath.Join(root, "d"+strconv.Itoa(i))
+		if err := os.Symlink(d, filepath.Join(d, "self")); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+		if err := os.Chmod(filepath.Join(d, "locked"), 0); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.Chmod(filepath.Join(d, "locked"), 0o755) })
+	}
+
+	s := &scanner.Scanner{MaxDepth: -1, FollowSymlinks: true, ReportSymlinkCycles: true}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 5 {
+			_, errs := s.ScanSyncPartial(root)
+			if len(errs) < n {
+				t.Errorf("expected at least %d errors, got %d", n, len(errs))
+			}
+			if _, err := s.ScanSync(root); err == nil {
+				t.Error("expected an error")
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("scan stalled on a burst of errors")
+	}
+}
+
+func TestScanContextStopsWorkers(t *testing.T) {
+	root := t.TempDir()
+	var paths []string
+	for i := range 500 {
+		paths = append(paths, filepath.Join("d"+strconv.Itoa(i%50), "e"+strconv.Itoa(i), "f"))
+	}
+	writeTree(t, root, paths...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var visited int64
+	rc := make(chan string)
+	ec := make(chan error)
+	scanner.ScanContext(ctx, root, -1, nil, rc, ec, scanner.WithProgressCounter(&visited))
+
+	<-rc
+	cancel()
+	var errs []error
+	for rc != nil || ec != nil {
+		select {
+		case _, ok := <-rc:
+			if !ok {
+				rc = nil
+			}
+		case err, ok := <-ec:
+			if !ok {
+				ec = nil
+				continue
+			}
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) != 1 || !errors.Is(errs[0], context.Canceled) || !errors.Is(errs[0], scanner.ErrCanceled) {
+		t.Fatalf("expected a single cancellation error, got %v", errs)
+	}
+	// 50 first level directories, and a directory and a file for each path.
+	if n, total := atomic.LoadInt64(&visited), int64(50+len(paths)*2); n >= total {
+		t.Fatalf("expected the workers to stop early, but they visited all %d entries", n)
+	}
+}
+
+func TestFindCaseCollisions(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "README.md", "Readme.md", "sub/a", "Sub/b", "other/readme.md", "other/x")
+	if des, err := os.ReadDir(root); err != nil || len(des) != 5 {
+		t.Skip("the filesystem is not case-sensitive")
+	}
+
+	r, err := scanner.FindCaseCollisions(root, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{
+		filepath.Join(root, "readme.md"): {filepath.Join(root, "README.md"), filepath.Join(root, "Readme.md")},
+		filepath.Join(root, "sub"):       {filepath.Join(root, "Sub"), filepath.Join(root, "sub")},
+	}
+	if !maps.EqualFunc(r, expected, slices.Equal) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestScanLanguageBreakdown(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "main.go", "sub/util.GO", "sub/app.ts", "README.md", "Makefile", "vendor/x.go")
+
+	r, err := scanner.ScanLanguageBreakdown(root, -1, map[string]string{".go": "Go", "TS": "TypeScript"}, func(p string, _ os.DirEntry) bool {
+		return !strings.HasPrefix(p, filepath.Join(root, "vendor"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]int{"Go": 2, "TypeScript": 1, "other": 2}; !maps.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestGroupBySize(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "b", "sub/a", "sub/deep/c")
+	if err := os.WriteFile(filepath.Join(root, "sub", "big"), make([]byte, 42), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := scanner.GroupBySize(root, -1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[int64][]string{
+		10: {filepath.Join(root, "b"), filepath.Join(root, "sub", "a"), filepath.Join(root, "sub", "deep", "c")},
+		42: {filepath.Join(root, "sub", "big")},
+	}
+	if !maps.EqualFunc(r, expected, slices.Equal) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestScanDepthStats(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a", "b", "sub/c", "sub/deep/d")
+
+	// sub is at depth 0, c and deep at 1, d at 2.
+	maxFound, avg, hist, err := scanner.ScanDepthStats(root, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[int]int{0: 3, 1: 2, 2: 1}; maxFound != 2 || avg != 4.0/6 || !maps.Equal(hist, expected) {
+		t.Fatalf("expected 2, %v and %v, got %d, %v and %v", 4.0/6, expected, maxFound, avg, hist)
+	}
+
+	maxFound, _, hist, err = scanner.ScanDepthStats(root, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[int]int{0: 3, 1: 2}; maxFound != 1 || !maps.Equal(hist, expected) {
+		t.Fatalf("expected 1 and %v with maxDepth 1, got %d and %v", expected, maxFound, hist)
+	}
+
+	maxFound, avg, hist, err = scanner.ScanDepthStats(t.TempDir(), -1)
+	if err != nil || maxFound != 0 || avg != 0 || len(hist) != 0 {
+		t.Fatalf("expected zero values for an empty root, got %d, %v, %v, %v", maxFound, avg, hist, err)
+	}
+}
+
+func TestFindDuplicateNames(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a/notes.txt", "b/c/notes.txt", "notes.txt", "a/unique.txt", "b/Notes.txt")
+
+	r, err := scanner.FindDuplicateNames(root, -1, scanner.FilterFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{"notes.txt": {filepath.Join(root, "a", "notes.txt"), filepath.Join(root, "b", "c", "notes.txt"), filepath.Join(root, "notes.txt")}}
+	if len(r) != 1 || !slices.Equal(r["notes.txt"], expected["notes.txt"]) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestScanSizeByExtension(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a.go", "b.GO", "sub/c.txt", "Makefile")
+
+	r, err := scanner.ScanSizeByExtension(root, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]int64{".go": 20, ".txt": 10, "": 10}; !maps.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestFilterCombinators(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a.go", ".b.go", "c.txt", "d.go/e")
+
+	calls := 0
+	counting := func(string, os.DirEntry) bool { calls++; return true }
+	r, err := scanner.ScanSync(root, 0, scanner.And(scanner.FilterFile, scanner.FilterByExtension(".go"), scanner.Not(scanner.FilterHidden), counting))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{filepath.Join(root, "a.go")}; !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+	if calls != 1 {
+		t.Fatalf("expected And to stop at the first rejecting filter, the last one ran %d times", calls)
+	}
+
+	r, err = scanner.ScanSync(root, 0, scanner.Or(scanner.FilterDir, scanner.FilterByExtension(".txt")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(r)
+	if expected := []string{filepath.Join(root, "c.txt"), filepath.Join(root, "d.go")}; !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestIsHiddenEntry(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, ".dot", ".dir/x", "visible", "~backup", "#autosave")
+
+	expected := map[string]bool{".dot": true, ".dir": true, "visible": false, "~backup": true, "#autosave": true}
+	if runtime.GOOS == "windows" {
+		// Only dot names and the hidden attribute count on Windows.
+		expected["~backup"], expected["#autosave"] = false, false
+	}
+	des, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, de := range des {
+		p := filepath.Join(root, de.Name())
+		if got := scanner.IsHiddenEntry(p, de); got != expected[de.Name()] || got != scanner.IsHidden(p) {
+			t.Errorf("%s: expected %v like IsHidden, got %v", de.Name(), expected[de.Name()], got)
+		}
+	}
+}
+
+func TestScanDedupErrors(t *testing.T) {
+	tmp := t.TempDir()
+	writeTree(t, tmp, "root/f", "t1/f", "t2/f")
+	links := [][2]string{{"t1", "root/x"}, {"t2", "t1/y1"}, {"t2", "t1/y2"}, {"t2", "t1/y3"}}
+	for _, l := range links {
+		if err := os.Symlink(filepath.Join(tmp, l[0]), filepath.Join(tmp, l[1])); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	for dedup, expected := range map[bool]int{false: 3, true: 1} {
+		s := &scanner.Scanner{MaxDepth: -1, FollowSymlinks: true, MaxSymlinkDepth: 1, DedupErrors: dedup}
+		_, errs := s.ScanSyncPartial(filepath.Join(tmp, "root"))
+		if len(errs) != expected {
+			t.Errorf("dedup %v: expected %d errors, got %v", dedup, expected, errs)
+		}
+	}
+}
+
+func TestFilterByName(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "report-01.csv", "report-1.csv", "app.log", "logs.d/x")
+
+	for pattern, expected := range map[string][]string{
+		"report-??.csv": {"report-01.csv"},
+		"*.log":         {"app.log"},
+		"*.d":           {"logs.d"},
+		"[":             nil,
+	} {
+		r, err := scanner.ScanSync(root, 0, scanner.FilterByName(pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, p := range r {
+			names = append(names, filepath.Base(p))
+		}
+		if !slices.Equal(names, expected) {
+			t.Errorf("%q: expected %v, got %v", pattern, expected, names)
+		}
+	}
+}
+
+func drainRich(mc <-chan scanner.RichMatch, ec <-chan error) ([]scanner.RichMatch, []error) {
+	var ms []scanner.RichMatch
+	var errs []error
+	for mc != nil || ec != nil {
+		select {
+		case m, ok := <-mc:
+			if !ok {
+				mc = nil
+				continue
+			}
+			ms = append(ms, m)
+		case err, ok := <-ec:
+			if !ok {
+				ec = nil
+				continue
+			}
+			errs = append(errs, err)
+		}
+	}
+	return ms, errs
+}
+
+func TestScanFull(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a/1.go", "a/2.txt", "a/b/3.go", "vendor/4.go", "5.go")
+
+	t.Run("metrics", func(t *testing.T) {
+		mc, m, ec := scanner.ScanFull(context.Background(), scanner.Scanner{MaxDepth: -1, Filter: scanner.FilterByExtension(".go")}, root)
+		ms, errs := drainRich(mc, ec)
+		if len(errs) != 0 || len(ms) != 4 {
+			t.Fatalf("expected 4 matches and no error, got %v and %v", ms, errs)
+		}
+		got := [5]int64{m.Entries.Load(), m.Matches.Load(), m.Dirs.Load(), m.Bytes.Load(), m.Errors.Load()}
+		if expected := [5]int64{8, 4, 4, 40, 0}; got != expected {
+			t.Fatalf("expected entries, matches, dirs, bytes and errors %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("descend and concurrency", func(t *testing.T) {
+		opts := scanner.Scanner{
+			MaxDepth:    1,
+			Concurrency: 1,
+			Filter:      scanner.FilterFile,
+			Descend:     func(p string, _ os.DirEntry) bool { return filepath.Base(p) != "vendor" },
+		}
+		mc, m, ec := scanner.ScanFull(context.Background(), opts, root)
+		ms, errs := drainRich(mc, ec)
+		var rels []string
+		for _, r := range ms {
+			rel, _ := filepath.Rel(root, r.Path)
+			rels = append(rels, filepath.ToSlash(rel))
+		}
+		slices.Sort(rels)
+		if expected := []string{"5.go", "a/1.go", "a/2.txt"}; len(errs) != 0 || !slices.Equal(rels, expected) {
+			t.Fatalf("expected %v, got %v and %v", expected, rels, errs)
+		}
+		if m.Dirs.Load() != 2 {
+			t.Fatalf("expected the root and a to be read, got %d directories", m.Dirs.Load())
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		mc, m, ec := scanner.ScanFull(ctx, scanner.Scanner{MaxDepth: -1}, root)
+		ms, errs := drainRich(mc, ec)
+		if len(ms) != 0 || len(errs) != 1 || !errors.Is(errs[0], scanner.ErrCanceled) {
+			t.Fatalf("expected a single ErrCanceled and no match, got %v and %v", ms, errs)
+		}
+		if m.Entries.Load() != 0 || m.Errors.Load() != 0 {
+			t.Fatalf("expected no entry visited and no counted error, got %d and %d", m.Entries.Load(), m.Errors.Load())
+		}
+	})
+
+	t.Run("byte budget", func(t *testing.T) {
+		opts := scanner.Scanner{MaxDepth: -1, Serial: true, Filter: scanner.FilterRegular, MaxBytes: 25}
+		mc, m, ec := scanner.ScanFull(context.Background(), opts, root)
+		ms, errs := drainRich(mc, ec)
+		if len(ms) != 2 || len(errs) != 1 || !errors.Is(errs[0], scanner.ErrByteBudgetExceeded) {
+			t.Fatalf("expected 2 matches and ErrByteBudgetExceeded, got %v and %v", ms, errs)
+		}
+		if m.Bytes.Load() != 20 || m.Matches.Load() != 2 {
+			t.Fatalf("expected 20 bytes in 2 matches, got %d in %d", m.Bytes.Load(), m.Matches.Load())
+		}
+	})
+}
+
+func TestFilterByRegex(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "node_modules/x/index.js", "src/index.js", "logs/2024-01-15.log")
+
+	sep := regexp.QuoteMeta(string(filepath.Separator))
+	r, err := scanner.ScanSync(root, -1, scanner.And(scanner.FilterFile, scanner.FilterByRegex(regexp.MustCompile(sep+`node_modules`+sep+`|\d{4}-\d{2}-\d{2}`))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(r)
+	expected := []string{filepath.Join(root, "logs", "2024-01-15.log"), filepath.Join(root, "node_modules", "x", "index.js")}
+	if !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestFilterByModTime(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "old", "new")
+	cut := time.Now().Add(-30 * 24 * time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "old"), cut.Add(-time.Hour), cut.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	for op, expected := range map[string]string{"<": "old", ">": "new"} {
+		r, err := scanner.ScanSync(root, 0, scanner.FilterByModTime(cut, op))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(r, []string{filepath.Join(root, expected)}) {
+			t.Errorf("%s: expected %s, got %v", op, expected, r)
+		}
+	}
+}
+
+func TestScanSymlinkCycles(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a/b/f", "c/g")
+	links := [][2]string{{"..", "a/up"}, {".", "a/b/self"}, {"../../c", "a/b/c"}}
+	for _, l := range links {
+		if err := os.Symlink(l[0], filepath.Join(root, l[1])); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	done := make(chan struct{})
+	var r []string
+	var errs []error
+	go func() {
+		defer close(done)
+		s := &scanner.Scanner{MaxDepth: -1, FollowSymlinks: true, ReportSymlinkCycles: true}
+		r, errs = s.ScanSyncPartial(root)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("scan loops on symlink cycles")
+	}
+
+	if len(errs) != 2 {
+		t.Fatalf("expected the 2 cycles to be reported, got %v", errs)
+	}
+	for _, err := range errs {
+		if !errors.Is(err, scanner.ErrSymlinkCycle) {
+			t.Fatalf("expected ErrSymlinkCycle, got %v", err)
+		}
+	}
+	// a/b/c is not a cycle: c is followed once.
+	if !slices.Contains(r, filepath.Join(root, "a", "b", "c", "g")) {
+		t.Fatalf("expected the link to a sibling to be followed, got %v", r)
+	}
+}
+
+func TestScanWithConcurrency(t *testing.T) {
+	root := t.TempDir()
+	var paths []string
+	for i := range 20 {
+		paths = append(paths, filepath.Join("d"+strconv.Itoa(i), "f"))
+	}
+	writeTree(t, root, paths...)
+
+	var running, peak atomic.Int64
+	filter := func(string, os.DirEntry) bool {
+		n := running.Add(1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		time.Sleep(time.Millisecond)
+		running.Add(-1)
+		return true
+	}
+
+	rc := make(chan string)
+	ec := make(chan error)
+	scanner.ScanWithConcurrency(root, -1, 1, filter, rc, ec)
+	n := 0
+	for rc != nil || ec != nil {
+		select {
+		case _, ok := <-rc:
+			if !ok {
+				rc = nil
+				continue
+			}
+			n++
+		case err, ok := <-ec:
+			if !ok {
+				ec = nil
+				continue
+			}
+			t.Error(err)
+		}
+	}
+
+	if n != 40 {
+		t.Fatalf("expected 40 entries, got %d", n)
+	}
+	if peak.Load() != 1 {
+		t.Fatalf("expected directories to be read one at a time, got %d at once", peak.Load())
+	}
+}
+
+func TestScanFSMapFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.go":          {Data: []byte("package a")},
+		"b/c.go":        {Data: []byte("package c")},
+		"b/d/e.txt":     {Data: []byte("e")},
+		"b/d/.hidden":   {Data: []byte("h")},
+		"f/g/h/i/j.txt": {Data: []byte("j")},
+	}
+
+	r, err := scanner.ScanFS(fsys, ".", -1, scanner.And(scanner.FilterFile, scanner.Not(scanner.FilterByExtension(".go"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"b/d/.hidden", "b/d/e.txt", "f/g/h/i/j.txt"}; !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+
+	r, err = scanner.ScanFS(fsys, "b", 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"b/c.go", "b/d"}; !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestScanLimit(t *testing.T) {
+	root := t.TempDir()
+	var paths []string
+	for i := range 100 {
+		paths = append(paths, filepath.Join("d"+strconv.Itoa(i%10), "f"+strconv.Itoa(i)))
+	}
+	writeTree(t, root, paths...)
+
+	for limit, expected := range map[int]int{7: 7, 0: 110, -1: 110, 1000: 110} {
+		r, err := scanner.ScanLimit(root, -1, limit, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r) != expected {
+			t.Errorf("limit %d: expected %d results, got %d", limit, expected, len(r))
+		}
+	}
+
+	r, err := scanner.ScanLimit(root, -1, 3, scanner.FilterFile, scanner.WithSerial())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(root, "d0", "f0"), filepath.Join(root, "d0", "f10"), filepath.Join(root, "d0", "f20")}
+	if !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestScanSorted(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a-b", "a/x", "a/c/y", "b", "a.txt")
+
+	r, err := scanner.ScanSorted(root, -1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rels []string
+	for _, p := range r {
+		rel, _ := filepath.Rel(root, p)
+		rels = append(rels, filepath.ToSlash(rel))
+	}
+	if expected := []string{"a", "a/c", "a/c/y", "a/x", "a-b", "a.txt", "b"}; !slices.Equal(rels, expected) {
+		t.Fatalf("expected %v, got %v", expected, rels)
+	}
+
+	serial, err := scanner.ScanSync(root, -1, nil, scanner.WithSerial())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(r, serial) {
+		t.Fatalf("expected the order of a serial scan %v, got %v", serial, r)
+	}
+}
+
+func TestFilterByExtensions(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a.png", "b.jpg", "c.JPG", "d.gif", "e.png/f")
+
+	r, err := scanner.ScanSorted(root, 0, scanner.FilterByExtensions("png", ".jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{filepath.Join(root, "a.png"), filepath.Join(root, "b.jpg")}; !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestFilterByExtensionFold(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a.jpg", "b.JPG", "c.Jpg", "d.jpeg", "e.png")
+
+	r, err := scanner.ScanSorted(root, 0, scanner.FilterByExtensionFold(".JPG"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(root, "a.jpg"), filepath.Join(root, "b.JPG"), filepath.Join(root, "c.Jpg")}
+	if !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+
+	r, err = scanner.ScanSorted(root, 0, scanner.FilterByExtension("jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{filepath.Join(root, "a.jpg")}; !slices.Equal(r, expected) {
+		t.Fatalf("expected exact case match %v, got %v", expected, r)
+	}
+}
+
+func TestFilterByPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not supported on Windows")
+	}
+	root := t.TempDir()
+	writeTree(t, root, "private", "shared")
+	if err := os.Chmod(filepath.Join(root, "private"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(root, "shared"), 0o666); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := scanner.ScanSorted(root, 0, scanner.FilterByPermissions(0o002, 0o002))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{filepath.Join(root, "shared")}; !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a.txt", "b.txt", "sub/c.txt", "sub/d.go")
+
+	var r []string
+	err := scanner.Walk(root, -1, scanner.FilterByExtension("txt"), func(p string, de os.DirEntry) error {
+		r = append(r, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(r)
+	expected := []string{filepath.Join(root, "a.txt"), filepath.Join(root, "b.txt"), filepath.Join(root, "sub", "c.txt")}
+	if !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = scanner.Walk(root, -1, scanner.FilterRegular, func(string, os.DirEntry) error {
+		calls++
+		return stop
+	})
+	if err != stop {
+		t.Fatalf("expected the error returned by fn, got %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected fn to be called once, got %d calls", calls)
+	}
+}
+
+func TestScanErrorPath(t *testing.T) {
+	root := t.TempDir()
+	missing := filepath.Join(root, "missing")
+
+	_, err := scanner.ScanSync(missing, -1, nil)
+	var se *scanner.ScanError
+	if !errors.As(err, &se) {
+		t.Fatalf("expected a *ScanError, got %T: %v", err, err)
+	}
+	if se.Path != missing {
+		t.Fatalf("expected path %q, got %q", missing, se.Path)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected the error to match fs.ErrNotExist, got %v", err)
+	}
+	if !strings.Contains(err.Error(), missing) {
+		t.Fatalf("expected the message to name %q, got %q", missing, err)
+	}
+}
+
+func TestScanPrune(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "main.go", ".git/config", "node_modules/x/index.js", "pkg/a.go", "pkg/node_modules/y.js")
+
+	r, err := scanner.ScanPrune(root, -1, func(p string, de os.DirEntry) (bool, bool) {
+		if de.IsDir() {
+			return false, de.Name() != ".git" && de.Name() != "node_modules"
+		}
+		return true, false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(r)
+	expected := []string{filepath.Join(root, "main.go"), filepath.Join(root, "pkg", "a.go")}
+	if !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestExclude(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "main.go", "main.tmp", ".git/config", "node_modules/x.js", "pkg/a.go", "pkg/b.tmp")
+
+	exclude := scanner.Exclude("node_modules", ".git", "*.tmp", "[")
+	r, err := scanner.ScanSorted(root, -1, scanner.And(scanner.FilterRegular, exclude), scanner.WithDescendFilter(exclude))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(root, "main.go"), filepath.Join(root, "pkg", "a.go")}
+	if !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestScanGitignore(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root,
+		"main.go", "debug.log", "keep.log", ".git/HEAD",
+		"build/out.bin", "docs/build", "vendor/lib.go",
+		"pkg/a.go", "pkg/a.tmp", "pkg/gen/z.go", "pkg/sub/gen/y.go",
+	)
+	ignore := map[string]string{
+		".gitignore":     "# comment\n*.log\n!keep.log\nbuild/\n/vendor\n",
+		"pkg/.gitignore": "*.tmp\n/gen\n",
+	}
+	for name, content := range ignore {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := scanner.ScanGitignore(root, -1, scanner.FilterRegular)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(r)
+	var expected []string
+	for _, p := range []string{".gitignore", "docs/build", "keep.log", "main.go", "pkg/.gitignore", "pkg/a.go", "pkg/sub/gen/y.go"} {
+		expected = append(expected, filepath.Join(root, filepath.FromSlash(p)))
+	}
+	slices.Sort(expected)
+	if !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestStateAndRuntimeDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the XDG variables are not used on windows")
+	}
+	t.Setenv("XDG_STATE_HOME", "/state")
+	t.Setenv("XDG_RUNTIME_DIR", "")
+
+	if d, err := scanner.StateDir("app"); err != nil || d != filepath.Join("/state", "app") {
+		t.Errorf("expected %q, got %q (%v)", filepath.Join("/state", "app"), d, err)
+	}
+	if d, err := scanner.RuntimeDir("app"); err != nil || d != filepath.Join(os.TempDir(), "app") {
+		t.Errorf("expected %q, got %q (%v)", filepath.Join(os.TempDir(), "app"), d, err)
+	}
+}
+
+func TestEnsureDirs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the XDG variables are not used on windows")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, v := range []string{"XDG_CONFIG_HOME", "XDG_DATA_HOME", "XDG_CACHE_HOME", "XDG_STATE_HOME", "XDG_RUNTIME_DIR"} {
+		t.Setenv(v, filepath.Join(home, strings.ToLower(v)))
+	}
+
+	for name, ensure := range map[string]func(string) (string, error){
+		"config":  scanner.EnsureConfigDir,
+		"data":    scanner.EnsureDataDir,
+		"cache":   scanner.EnsureCacheDir,
+		"state":   scanner.EnsureStateDir,
+		"runtime": scanner.EnsureRuntimeDir,
+	} {
+		// The second call finds the directory created by the first one.
+		for range 2 {
+			d, err := ensure("app")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(d, home) || filepath.Base(d) != "app" {
+				t.Fatalf("%s: expected a directory under %s, got %s", name, home, d)
+			}
+			i, err := os.Stat(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !i.IsDir() || i.Mode().Perm() != 0o700 {
+				t.Fatalf("%s: expected a 0700 directory, got %v", name, i.Mode())
+			}
+		}
+	}
+
+	// An existing directory keeps its mode.
+	existing := filepath.Join(home, "xdg_state_home", "shared")
+	if err := os.Mkdir(existing, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(existing, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := scanner.EnsureStateDir("shared"); err != nil || d != existing {
+		t.Fatalf("expected %s, got %s (%v)", existing, d, err)
+	}
+	if i, err := os.Stat(existing); err != nil || i.Mode().Perm() != 0o755 {
+		t.Fatalf("expected the mode to be kept, got %v (%v)", i, err)
+	}
+}
+
+func TestScanSize(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a.txt", "b.txt", "sub/c.txt", "sub/d.go")
+
+	n, b, err := scanner.ScanSize(root, -1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 || b != 40 {
+		t.Fatalf("expected 5 entries and 40 bytes, got %d entries and %d bytes", n, b)
+	}
+
+	n, b, err = scanner.ScanSize(root, -1, scanner.FilterByExtension("txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || b != 30 {
+		t.Fatalf("expected 3 entries and 30 bytes, got %d entries and %d bytes", n, b)
+	}
+}
+
+func TestScanEntries(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a.txt", "sub/b.txt")
+
+	var infos []fs.FileInfo
+	var mu sync.Mutex
+	filter := func(_ string, de os.DirEntry) bool {
+		i, err := de.Info()
+		if err != nil {
+			return false
+		}
+		mu.Lock()
+		infos = append(infos, i)
+		mu.Unlock()
+		return i.Mode().IsRegular()
+	}
+
+	rc, ec := scanner.ScanEntries(root, -1, filter)
+	var r []string
+	for rc != nil || ec != nil {
+		select {
+		case e, ok := <-rc:
+			if !ok {
+				rc = nil
+				continue
+			}
+			i, err := e.Info()
+			if err != nil {
+				t.Fatal(err)
+			}
+			mu.Lock()
+			if !slices.Contains(infos, i) {
+				t.Errorf("expected the info of %s to be the one the filter read", e.Path)
+			}
+			mu.Unlock()
+			r = append(r, e.Path)
+		case err, ok := <-ec:
+			if !ok {
+				ec = nil
+				continue
+			}
+			t.Error(err)
+		}
+	}
+	slices.Sort(r)
+	if expected := []string{filepath.Join(root, "a.txt"), filepath.Join(root, "sub", "b.txt")}; !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestScanCount(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a.txt", "b.go", "sub/c.txt", "sub/deep/d.txt")
+
+	n, err := scanner.ScanCount(root, -1, scanner.FilterByExtension("txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := scanner.ScanSync(root, -1, scanner.FilterByExtension("txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || n != len(r) {
+		t.Fatalf("expected 3 matches like ScanSync, got %d (ScanSync found %d)", n, len(r))
+	}
+}
+
+func TestScanMulti(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a/x.txt", "a/b/y.txt", "c/z.txt")
+
+	roots := []string{filepath.Join(root, "a"), filepath.Join(root, "a", "b"), filepath.Join(root, "c"), filepath.Join(root, "c"), filepath.Join(root, "missing")}
+	r, err := scanner.ScanMulti(roots, -1, scanner.FilterRegular)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected the error of the missing root, got %v", err)
+	}
+	slices.Sort(r)
+	expected := []string{filepath.Join(root, "a", "b", "y.txt"), filepath.Join(root, "a", "x.txt"), filepath.Join(root, "c", "z.txt")}
+	if !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestScanRel(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a.txt", "sub/b.txt")
+	t.Chdir(root)
+
+	expected := []string{"a.txt", filepath.Join("sub", "b.txt")}
+	for _, r := range []string{root, root + string(filepath.Separator), "."} {
+		paths, err := scanner.ScanRel(r, -1, scanner.FilterRegular)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(paths)
+		if !slices.Equal(paths, expected) {
+			t.Errorf("root %q: expected %v, got %v", r, expected, paths)
+		}
+	}
+}
+
+func TestFilterEmpty(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "full", "dir/full")
+	if err := os.WriteFile(filepath.Join(root, "empty"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "hollow"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		filter   func(string, os.DirEntry) bool
+		expected []string
+	}{
+		{"empty", scanner.FilterEmpty, []string{filepath.Join(root, "empty"), filepath.Join(root, "hollow")}},
+		{"nonempty", scanner.FilterNonEmpty, []string{filepath.Join(root, "dir"), filepath.Join(root, "full")}},
+	} {
+		r, err := scanner.ScanSorted(root, 0, tc.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(r, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.expected, r)
+		}
+	}
+}
+
+func TestScanSkipErrors(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a/x", "b/y", "c/z")
+	for _, d := range []string{"a", "b", "c"} {
+		if err := os.Symlink(filepath.Join(root, d), filepath.Join(root, d, "self")); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	s := &scanner.Scanner{MaxDepth: -1, Filter: scanner.FilterRegular, FollowSymlinks: true, ReportSymlinkCycles: true}
+	if _, err := s.ScanSync(root); !errors.Is(err, scanner.ErrSymlinkCycle) {
+		t.Fatalf("expected a cycle error, got %v", err)
+	}
+
+	s.SkipErrors = func(err error) bool { return errors.Is(err, scanner.ErrSymlinkCycle) }
+	r, err := s.ScanSync(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(r)
+	expected := []string{filepath.Join(root, "a", "x"), filepath.Join(root, "b", "y"), filepath.Join(root, "c", "z")}
+	if !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestScanDirEntries(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a", "sub/b", "sub/deep/c")
+
+	r, err := scanner.ScanDirEntries(root, -1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]fs.FileMode)
+	for _, de := range r {
+		got[de.Name()] = de.Type()
+	}
+	expected := map[string]fs.FileMode{"a": 0, "sub": fs.ModeDir, "b": 0, "deep": fs.ModeDir, "c": 0}
+	if len(r) != len(expected) || !maps.Equal(got, expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for _, de := range r {
+		if de.Name() == "c" {
+			if i, err := de.Info(); err != nil || i.Size() != 10 {
+				t.Fatalf("expected the info of c on disk, got %v, %v", i, err)
+			}
+		}
+	}
+}
+
+func TestScanSyncTransform(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a.go", "b.txt", "sub/c.go")
+
+	// Paths are rewritten after RelativeBase, and the empty ones are dropped.
+	r, err := scanner.ScanSorted(root, -1, scanner.FilterRegular, scanner.WithRelativeBase(root), scanner.WithTransform(func(p string) string {
+		if filepath.Ext(p) != ".go" {
+			return ""
+		}
+		return strings.ToUpper(filepath.ToSlash(p))
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"A.GO", "SUB/C.GO"}; !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestScanSyncRelativeBase(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "root")
+	writeTree(t, tmp, "root/a/x", "base/y")
+
+	r, err := scanner.ScanSync(root, -1, scanner.FilterRegular, scanner.WithRelativeBase(filepath.Join(tmp, "base")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{filepath.Join("..", "root", "a", "x")}; !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+
+	// Without a working directory, a relative base can't be made absolute and
+	// the paths can't be made relative to it.
+	wd := filepath.Join(tmp, "wd")
+	if err := os.Mkdir(wd, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(wd)
+	if err := os.Remove(wd); err != nil {
+		t.Skipf("can't remove the working directory: %v", err)
+	}
+	if _, err := os.Getwd(); err == nil {
+		t.Skip("the working directory is still known")
+	}
+
+	r, errs := scanner.ScanSyncPartial(root, -1, scanner.FilterRegular, scanner.WithRelativeBase("base"))
+	if expected := []string{filepath.Join(root, "a", "x")}; !slices.Equal(r, expected) {
+		t.Fatalf("expected the absolute paths %v, got %v", expected, r)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("expected one error, got %v", errs)
+	}
+}
+
+func TestFilterByChecksumSet(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "known", "sub/copy")
+	if err := os.WriteFile(filepath.Join(root, "other"), []byte("different"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	set := map[string]bool{fmt.Sprintf("%x", sha256.Sum256([]byte("0123456789"))): true}
+
+	r, err := scanner.ScanSync(root, -1, scanner.FilterByChecksumSet("sha256", set))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(r)
+	if expected := []string{filepath.Join(root, "known"), filepath.Join(root, "sub", "copy")}; !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+
+	r, err = scanner.ScanSync(root, -1, scanner.FilterByChecksumSet("crc32", set))
+	if err != nil || len(r) != 0 {
+		t.Fatalf("expected no match with an unsupported algorithm, got %v, %v", r, err)
+	}
+}
+
+func TestVerifyManifest(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a/x", "y")
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte("0123456789")))
+	manifest := filepath.Join(t.TempDir(), "manifest")
+	write := func(lines ...string) {
+		t.Helper()
+		if err := os.WriteFile(manifest, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("# comment", "a/x  "+sum, "", "y\t"+strings.ToUpper(sum))
+	ok, mismatches, missing, err := scanner.VerifyManifest(root, manifest, "sha256")
+	if err != nil || !ok || len(mismatches) != 0 || len(missing) != 0 {
+		t.Fatalf("expected an intact manifest, got %v, %v, %v, %v", ok, mismatches, missing, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "y"), []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	write("a/x  "+sum, "y  "+sum, "gone  "+sum)
+	ok, mismatches, missing, err = scanner.VerifyManifest(root, manifest, "sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok || !slices.Equal(mismatches, []string{"y"}) || !slices.Equal(missing, []string{"gone"}) {
+		t.Fatalf("expected y mismatching and gone missing, got %v, %v, %v", ok, mismatches, missing)
+	}
+
+	// Rewritten paths don't change how the files are found.
+	ok, mismatches, missing, err = scanner.VerifyManifest(root, manifest, "sha256", scanner.WithRelativeBase(t.TempDir()), scanner.WithTransform(strings.ToUpper))
+	if err != nil || ok || !slices.Equal(mismatches, []string{"y"}) || !slices.Equal(missing, []string{"gone"}) {
+		t.Fatalf("expected the same result with rewritten paths, got %v, %v, %v, %v", ok, mismatches, missing, err)
+	}
+
+	write("a/x  "+sum, "malformed")
+	if ok, _, _, err = scanner.VerifyManifest(root, manifest, "sha256"); err == nil || ok || !strings.Contains(err.Error(), ":2:") {
+		t.Fatalf("expected the malformed line 2 to be reported, got %v, %v", ok, err)
+	}
+}
+
+func TestScanSyncSkipPaths(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a/x", "b/y", "b/z", "c")
+
+	r, err := scanner.ScanSync(root, -1, nil, scanner.WithSkipPaths(filepath.Join(root, "a"), filepath.Join(root, "b", "z")+string(filepath.Separator), filepath.Join(root, "c")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(r)
+	if expected := []string{filepath.Join(root, "b"), filepath.Join(root, "b", "y")}; !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+
+	r, err = scanner.ScanSync(root, -1, nil, scanner.WithSkipPaths(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 0 {
+		t.Fatalf("expected nothing with the root skipped, got %v", r)
+	}
+}
+
+func TestScanSyncSkipErrors(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Getuid() == 0 {
+		t.Skip("permissions are not enforced")
+	}
+	root := t.TempDir()
+	writeTree(t, root, "a/x", "locked/y", "z")
+	if err := os.Chmod(filepath.Join(root, "locked"), 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(filepath.Join(root, "locked"), 0o755) })
+
+	r, err := scanner.ScanSyncSkipErrors(root, -1, scanner.FilterRegular)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(r)
+	if expected := []string{filepath.Join(root, "a", "x"), filepath.Join(root, "z")}; !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestScanBuffered(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a", "b", "sub/c")
+
+	// With enough room, the scan completes before anything is received.
+	rc, ec := scanner.ScanBuffered(root, -1, 8, nil)
+	deadline := time.After(5 * time.Second)
+	for len(rc) < 4 {
+		select {
+		case <-deadline:
+			t.Fatalf("expected 4 buffered paths, got %d", len(rc))
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	var r []string
+	for p := range rc {
+		r = append(r, p)
+	}
+	for err := range ec {
+		t.Error(err)
+	}
+	slices.Sort(r)
+	expected := []string{filepath.Join(root, "a"), filepath.Join(root, "b"), filepath.Join(root, "sub"), filepath.Join(root, "sub", "c")}
+	if !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestFilterByContent(t *testing.T) {
+	root := t.TempDir()
+	files := map[string][]byte{
+		"small.bin": {0, 1, 'M', 'A', 'G', 'I', 'C', 0},
+		"large.bin": append(bytes.Repeat([]byte{0}, 100), "MAGIC"...),
+		"other.txt": []byte("no magic here"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(root, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		maxSize  int64
+		expected []string
+	}{
+		{0, []string{filepath.Join(root, "large.bin"), filepath.Join(root, "small.bin")}},
+		{50, []string{filepath.Join(root, "small.bin")}},
+	} {
+		r, err := scanner.ScanSorted(root, 0, scanner.FilterByContent([]byte("MAGIC"), tc.maxSize))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(r, tc.expected) {
+			t.Errorf("maxSize %d: expected %v, got %v", tc.maxSize, tc.expected, r)
+		}
+	}
+}
+
+func TestFilterTextBinary(t *testing.T) {
+	root := t.TempDir()
+	files := map[string][]byte{
+		"text":       []byte("plain text\n"),
+		"empty":      nil,
+		"binary":     []byte("ELF\x00\x01\x02"),
+		"late":       append(bytes.Repeat([]byte("a"), 8000), 0),
+		"dir/nested": []byte("text"),
+	}
+	for name, data := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The NUL byte of late lies past the bytes read, and dir is not a regular file.
+	for name, c := range map[string]struct {
+		filter   func(string, os.DirEntry) bool
+		expected []string
+	}{
+		"text":   {scanner.FilterText, []string{filepath.Join(root, "empty"), filepath.Join(root, "late"), filepath.Join(root, "text")}},
+		"binary": {scanner.FilterBinary, []string{filepath.Join(root, "binary")}},
+	} {
+		r, err := scanner.ScanSorted(root, 0, c.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(r, c.expected) {
+			t.Errorf("%s: expected %v, got %v", name, c.expected, r)
+		}
+	}
+}
+
+func TestFilterByImageSize(t *testing.T) {
+	root := t.TempDir()
+	write := func(name string, w, h int, encode func(io.Writer, image.Image) error) {
+		t.Helper()
+		var b bytes.Buffer
+		if err := encode(&b, image.NewPaletted(image.Rect(0, 0, w, h), color.Palette{color.Black, color.White})); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name), b.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("wide.png", 100, 50, png.Encode)
+	write("tall.gif", 20, 200, func(w io.Writer, m image.Image) error { return gif.Encode(w, m, nil) })
+	write("square.JPG", 64, 64, func(w io.Writer, m image.Image) error { return jpeg.Encode(w, m, nil) })
+	// A PNG without an image extension is never opened, and a fake one can't be decoded.
+	write("png.data", 500, 500, png.Encode)
+	writeTree(t, root, "fake.png")
+
+	for _, c := range []struct {
+		w, h     int
+		expected []string
+	}{
+		{0, 0, []string{"square.JPG", "tall.gif", "wide.png"}},
+		{50, 50, []string{"square.JPG", "wide.png"}},
+		{10, 100, []string{"tall.gif"}},
+		{100, 50, []string{"wide.png"}},
+		{200, 200, nil},
+	} {
+		r, err := scanner.ScanSorted(root, 0, scanner.FilterByImageSize(c.w, c.h))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, p := range r {
+			names = append(names, filepath.Base(p))
+		}
+		if !slices.Equal(names, c.expected) {
+			t.Errorf("%dx%d: expected %v, got %v", c.w, c.h, c.expected, names)
+		}
+	}
+}
+
+func TestFilterByMIMEType(t *testing.T) {
+	root := t.TempDir()
+	files := map[string][]byte{
+		"picture":   []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"),
+		"fake.png":  []byte("just some text"),
+		"anim.data": []byte("GIF89a\x01\x00\x01\x00"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(root, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for mime, expected := range map[string][]string{
+		"image/png":  {filepath.Join(root, "picture")},
+		"image/":     {filepath.Join(root, "anim.data"), filepath.Join(root, "picture")},
+		"text/plain": {filepath.Join(root, "fake.png")},
+	} {
+		r, err := scanner.ScanSorted(root, 0, scanner.FilterByMIMEType(mime))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(r, expected) {
+			t.Errorf("%s: expected %v, got %v", mime, expected, r)
+		}
+	}
+}
+
+func TestAll(t *testing.T) {
+	root := t.TempDir()
+	var paths []string
+	for i := range 50 {
+		paths = append(paths, filepath.Join("d"+strconv.Itoa(i), "f"))
+	}
+	writeTree(t, root, paths...)
+
+	var r []string
+	for p := range scanner.All(root, -1, scanner.FilterRegular) {
+		r = append(r, p)
+	}
+	if len(r) != len(paths) {
+		t.Fatalf("expected %d paths, got %d", len(paths), len(r))
+	}
+
+	var visited int64
+	for range scanner.All(root, -1, nil, scanner.WithProgressCounter(&visited)) {
+		break
+	}
+	// The workers have returned once the loop is over, so the counter no longer moves.
+	n := atomic.LoadInt64(&visited)
+	time.Sleep(10 * time.Millisecond)
+	if m := atomic.LoadInt64(&visited); m != n || m == 2*int64(len(paths)) {
+		t.Fatalf("expected the traversal to stop at the break, visited %d then %d entries", n, m)
+	}
+
+	var errs []error
+	for p, err := range scanner.AllErr(filepath.Join(root, "missing"), -1, nil) {
+		if p != "" {
+			t.Errorf("unexpected path %s", p)
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], fs.ErrNotExist) {
+		t.Fatalf("expected a single not exist error, got %v", errs)
+	}
+}
+
+func TestFilterNewerThan(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "old", "ref", "new")
+	now := time.Now()
+	for name, age := range map[string]time.Duration{"old": 2 * time.Hour, "ref": time.Hour, "new": 0} {
+		if err := os.Chtimes(filepath.Join(root, name), now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newer, err := scanner.FilterNewerThan(filepath.Join(root, "ref"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	older, err := scanner.FilterOlderThan(filepath.Join(root, "ref"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, filter := range map[string]func(string, os.DirEntry) bool{"new": newer, "old": older} {
+		r, err := scanner.ScanSync(root, 0, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := []string{filepath.Join(root, name)}; !slices.Equal(r, expected) {
+			t.Errorf("expected %v, got %v", expected, r)
+		}
+	}
+
+	if _, err := scanner.FilterNewerThan(filepath.Join(root, "missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected a not exist error, got %v", err)
+	}
+}
+
+func TestScanBoundedGoroutines(t *testing.T) {
+	root := t.TempDir()
+	var paths []string
+	for i := range 300 {
+		paths = append(paths, filepath.Join("d"+strconv.Itoa(i), "sub", "f"))
+	}
+	writeTree(t, root, paths...)
+
+	base := runtime.NumGoroutine()
+	var peak atomic.Int64
+	filter := func(string, os.DirEntry) bool {
+		n := int64(runtime.NumGoroutine())
+		for m := peak.Load(); n > m && !peak.CompareAndSwap(m, n); m = peak.Load() {
+		}
+		return true
+	}
+
+	r, err := scanner.ScanSync(root, -1, filter, scanner.WithConcurrency(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 3*len(paths) {
+		t.Fatalf("expected %d paths, got %d", 3*len(paths), len(r))
+	}
+	// The workers, plus the goroutine running the scan for ScanSync.
+	if extra := peak.Load() - int64(base); extra > 4+1 {
+		t.Fatalf("expected at most %d goroutines on top of the %d running, peaked at %d more", 4+1, base, extra)
+	}
+}
+
+func TestEstimateProgressTotal(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a.go", "b.txt", "sub/c.go", "sub/deep/d.go", "other/e.txt")
+
+	// The filter and the depth change which entries are visited, the estimate follows them.
+	for _, d := range []int{-1, 0, 1} {
+		total, err := scanner.EstimateProgressTotal(root, d, scanner.FilterByExtension(".go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var done int64
+		if _, err := scanner.ScanSync(root, d, scanner.FilterByExtension(".go"), scanner.WithProgressCounter(&done)); err != nil {
+			t.Fatal(err)
+		}
+		if total == 0 || total != atomic.LoadInt64(&done) {
+			t.Errorf("maxDepth %d: expected the counter to reach the estimate %d, got %d", d, total, done)
+		}
+	}
+}
+
+func TestScanProgress(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a", "b", "sub/c")
+
+	var calls []int64
+	slow := func(string, os.DirEntry) bool {
+		time.Sleep(5 * time.Millisecond)
+		return true
+	}
+	r, err := scanner.ScanProgress(root, -1, slow, time.Millisecond, func(seen int64) {
+		calls = append(calls, seen)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) < 2 {
+		t.Fatalf("expected periodic calls and a final one, got %v", calls)
+	}
+	if !slices.IsSorted(calls) || calls[len(calls)-1] != 4 || len(r) != 4 {
+		t.Fatalf("expected increasing counts ending with 4, got %v", calls)
+	}
+}
+
+func TestScanAtDepth(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a", "b/c", "b/d/e", "f/g/h/i")
+
+	r, err := scanner.ScanAtDepth(root, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(r)
+	expected := []string{filepath.Join(root, "b", "c"), filepath.Join(root, "b", "d"), filepath.Join(root, "f", "g")}
+	if !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+
+	if r, err := scanner.ScanAtDepth(root, -1, nil); err != nil || len(r) != 0 {
+		t.Fatalf("expected nothing for a negative depth, got %v, %v", r, err)
+	}
+}
+
+func TestFilterSymlinkTargets(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "file", "dir/x")
+	for link, target := range map[string]string{"to-file": "file", "to-dir": "dir", "broken": "missing"} {
+		if err := os.Symlink(filepath.Join(root, target), filepath.Join(root, link)); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		filter   func(string, os.DirEntry) bool
+		expected string
+	}{
+		{"FilterSymlinkToDir", scanner.FilterSymlinkToDir, "to-dir"},
+		{"FilterSymlinkToFile", scanner.FilterSymlinkToFile, "to-file"},
+		{"FilterBrokenSymlink", scanner.FilterBrokenSymlink, "broken"},
+	} {
+		r, err := scanner.ScanSync(root, 0, tc.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := []string{filepath.Join(root, tc.expected)}; !slices.Equal(r, expected) {
+			t.Errorf("%s: expected %v, got %v", tc.name, expected, r)
+		}
+	}
+}
+
+func TestScanRoots(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "src/a/b.go", "vendor/x/y.go", "vendor/z.go")
+
+	r, err := scanner.ScanRoots([]scanner.RootSpec{
+		{Path: filepath.Join(root, "src"), MaxDepth: -1},
+		{Path: filepath.Join(root, "vendor"), MaxDepth: 0},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(r)
+	var expected []string
+	for _, p := range []string{"src/a", "src/a/b.go", "vendor/x", "vendor/z.go"} {
+		expected = append(expected, filepath.Join(root, filepath.FromSlash(p)))
+	}
+	if !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestScanSyncJoinErrors(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a/x", "b/y", "c/z")
+	for _, d := range []string{"a", "b"} {
+		if err := os.Symlink(filepath.Join(root, d), filepath.Join(root, d, "self")); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+
+	reportCycles := func(s *scanner.Scanner) { s.ReportSymlinkCycles = true }
+	r, err := scanner.ScanSyncJoinErrors(root, -1, scanner.FilterRegular, scanner.WithFollowSymlinks(), reportCycles)
+	if !errors.Is(err, scanner.ErrSymlinkCycle) {
+		t.Fatalf("expected the cycle errors, got %v", err)
+	}
+	if n := len(err.(interface{ Unwrap() []error }).Unwrap()); n != 2 {
+		t.Fatalf("expected 2 joined errors, got %d: %v", n, err)
+	}
+	if len(r) != 3 {
+		t.Fatalf("expected every file despite the errors, got %v", r)
+	}
+
+	if _, err := scanner.ScanSyncJoinErrors(root, -1, nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestFilterOpenable(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "a", "sub/b")
+
+	r, err := scanner.ScanSorted(root, -1, scanner.FilterOpenable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{filepath.Join(root, "a"), filepath.Join(root, "sub", "b")}; !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestFilterReparsePoint(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "file", "dir/x")
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(filepath.Join(root, "dir"), link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	r, err := scanner.ScanSorted(root, -1, scanner.FilterReparsePoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only Windows has reparse points, symbolic links among them.
+	var expected []string
+	if runtime.GOOS == "windows" {
+		expected = []string{link}
+	}
+	if !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
+
+func TestFilterExecutable(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, "run.sh", "notes.txt", "tool.EXE", "bin/tool")
+	if err := os.Chmod(filepath.Join(root, "bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(root, "run.sh"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := scanner.ScanSorted(root, 0, scanner.FilterExecutable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(root, "run.sh")}
+	if runtime.GOOS == "windows" {
+		expected = []string{filepath.Join(root, "tool.EXE")}
+	}
+	if !slices.Equal(r, expected) {
+		t.Fatalf("expected %v, got %v", expected, r)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !plan9
+
+package scanner
+
+import "syscall"
+
+// errConnRefused is the error of a connection attempt to a socket nothing listens on.
+var errConnRefused error = syscall.ECONNREFUSED
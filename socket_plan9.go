@@ -0,0 +1,8 @@
+//go:build plan9
+
+package scanner
+
+import "errors"
+
+// errConnRefused never matches on Plan 9, which has no Unix domain sockets.
+var errConnRefused = errors.New("connection refused")
@@ -0,0 +1,45 @@
+//go:build unix
+
+package scanner_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Tagliapietra96/scanner"
+)
+
+func TestFilterActiveSocket(t *testing.T) {
+	// Socket paths are limited to about 100 bytes, shorter than some test temporary directories.
+	root, err := os.MkdirTemp("", "sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	live, err := net.Listen("unix", filepath.Join(root, "live"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer live.Close()
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: filepath.Join(root, "stale"), Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+	writeTree(t, root, "file")
+
+	for name, filter := range map[string]func(string, os.DirEntry) bool{"live": scanner.FilterActiveSocket, "stale": scanner.FilterStaleSocket} {
+		r, err := scanner.ScanSync(root, 0, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := []string{filepath.Join(root, name)}; !slices.Equal(r, expected) {
+			t.Errorf("expected %v, got %v", expected, r)
+		}
+	}
+}
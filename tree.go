@@ -0,0 +1,81 @@
+package scanner
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// treeNode is an entry of the tree rendered by ScanTree, holding its children in traversal order.
+type treeNode struct {
+	name     string
+	children []*treeNode
+	index    map[string]*treeNode
+}
+
+// child returns the child of n with the given name, adding it if missing.
+func (n *treeNode) child(name string) *treeNode {
+	if c, ok := n.index[name]; ok {
+		return c
+	}
+	if n.index == nil {
+		n.index = make(map[string]*treeNode)
+	}
+	c := &treeNode{name: name}
+	n.index[name] = c
+	n.children = append(n.children, c)
+	return c
+}
+
+// write renders the children of n to w, each line starting with prefix.
+func (n *treeNode) write(w io.Writer, prefix string) error {
+	for i, c := range n.children {
+		branch, indent := "├── ", "│   "
+		if i == len(n.children)-1 {
+			branch, indent = "└── ", "    "
+		}
+		if _, err := fmt.Fprintln(w, prefix+branch+c.name); err != nil {
+			return err
+		}
+		if err := c.write(w, prefix+indent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScanTree scans the directory structure starting at root and writes the matching entries to w as an
+// indented tree, like the tree command, with root on the first line and box-drawing characters below it.
+// The traversal is serial, so entries appear in name order or in the order set with WithEntrySort.
+// The directories leading to a match are drawn even when the filter rejects them, to keep the tree connected.
+// Transform and RelativeBase are ignored. The tree is written even if part of root can't be read,
+// and the first traversal error is returned, unless writing to w fails first.
+// If maxDepth is a negative value, it will traverse all levels of the directory tree.
+func ScanTree(w io.Writer, root string, maxDepth int, filter func(string, os.DirEntry) bool, opts ...Option) error {
+	s := newScanner(maxDepth, filter, opts)
+	s.Serial = true
+	s.Transform = nil
+	s.RelativeBase = ""
+
+	var top treeNode
+	err := s.each(root, func(p string, _ os.DirEntry) {
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return
+		}
+		n := &top
+		for _, name := range strings.Split(rel, string(filepath.Separator)) {
+			n = n.child(name)
+		}
+	})
+
+	if _, werr := fmt.Fprintln(w, root); werr != nil {
+		return werr
+	}
+	if werr := top.write(w, ""); werr != nil {
+		return werr
+	}
+	return err
+}